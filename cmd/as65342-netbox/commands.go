@@ -0,0 +1,747 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/config"
+	"github.com/r3boot/as65342-netbox/lib/generator"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+// Environment contains everything which is shared between commands
+type Environment struct {
+	Netbox  *netboxclient.NetboxClient
+	Config  *config.Config
+	BaseURL string
+}
+
+// ExitError is returned by a command which completed, but wants the
+// program to exit with a non-zero status
+type ExitError struct {
+	Status int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Status)
+}
+
+type Command struct {
+	Name        string
+	Description string
+	Flags       *flag.FlagSet
+	Collections []netboxclient.Collection
+	Quiet       bool
+	// Daemon commands run until they are interrupted, instead of being
+	// bound to the api timeout
+	Daemon bool
+	Run    func(ctx context.Context, env *Environment) error
+}
+
+var commands []*Command = []*Command{
+	dnsCommand(),
+	dnsServeCommand(),
+	localDnsCommand(),
+	ansibleCommand(),
+	icinga2Command(),
+	rundeckCommand(),
+	backupCommand(),
+	allCommand(),
+	lintCommand(),
+	dnscheckCommand(),
+}
+
+func findCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// tsigKey returns the configured tsig key, or nil if no key is configured
+func tsigKey(cfg config.TsigConfig) (*generator.Tsig, error) {
+	if cfg.TsigName == "" {
+		return nil, nil
+	}
+
+	secret, err := cfg.GetTsigSecret()
+	if err != nil {
+		return nil, fmt.Errorf("GetTsigSecret: %v", err)
+	}
+
+	return &generator.Tsig{
+		Name:      cfg.TsigName,
+		Algorithm: cfg.TsigAlgorithm,
+		Secret:    secret,
+	}, nil
+}
+
+// dnsServer returns the nameserver which receives dynamic updates
+func dnsServer(cfg config.DnsUpdateConfig) (generator.DnsServer, error) {
+	server := generator.DnsServer{
+		Address: cfg.Server,
+		Timeout: cfg.Timeout,
+	}
+
+	var err error
+	server.Tsig, err = tsigKey(cfg.TsigConfig)
+	if err != nil {
+		return server, fmt.Errorf("tsigKey: %v", err)
+	}
+
+	return server, nil
+}
+
+// powerDNS returns the PowerDNS server whose zones are managed using its
+// HTTP api
+func powerDNS(cfg config.DnsPowerDNSConfig) (generator.PowerDNS, error) {
+	server := generator.PowerDNS{
+		URL:      cfg.URL,
+		ServerID: cfg.ServerID,
+		Kind:     cfg.Kind,
+		Timeout:  cfg.Timeout,
+	}
+
+	var err error
+	server.APIKey, err = cfg.GetAPIKey()
+	if err != nil {
+		return server, fmt.Errorf("GetAPIKey: %v", err)
+	}
+
+	return server, nil
+}
+
+// authServer returns the built-in nameserver described by cfg
+func authServer(cfg config.DnsServeConfig) (*generator.AuthServer, error) {
+	networks, err := cfg.TransferNetworks()
+	if err != nil {
+		return nil, fmt.Errorf("TransferNetworks: %v", err)
+	}
+
+	tsig, err := tsigKey(cfg.TsigConfig)
+	if err != nil {
+		return nil, fmt.Errorf("tsigKey: %v", err)
+	}
+
+	server := &generator.AuthServer{
+		Address:       cfg.Listen,
+		Refresh:       cfg.Refresh,
+		Timeout:       cfg.Timeout,
+		AllowTransfer: networks,
+		Tsig:          tsig,
+	}
+
+	for _, secondary := range cfg.Notify {
+		if _, _, err := net.SplitHostPort(secondary); err != nil {
+			secondary = net.JoinHostPort(secondary, "53")
+		}
+		server.Notify = append(server.Notify, secondary)
+	}
+
+	return server, nil
+}
+
+// dnssec returns the signing settings described by cfg
+func dnssec(cfg config.DnssecConfig) (*generator.Dnssec, error) {
+	algorithm, err := generator.ParseDnssecAlgorithm(cfg.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("ParseDnssecAlgorithm: %v", err)
+	}
+
+	return &generator.Dnssec{
+		KeyDir:     cfg.KeyDir,
+		Algorithm:  algorithm,
+		NSEC3:      cfg.NSEC3,
+		Iterations: cfg.NSEC3Iterations,
+		Salt:       cfg.NSEC3Salt,
+		Validity:   cfg.Validity,
+		Refresh:    cfg.Refresh,
+		Zones:      cfg.Zones,
+	}, nil
+}
+
+// views converts the configured views, and validates them
+func views(cfg []config.DnsViewConfig) ([]generator.View, error) {
+	views := []generator.View{}
+	for _, viewCfg := range cfg {
+		view := generator.View{
+			Name:         viewCfg.Name,
+			Vrfs:         viewCfg.Vrfs,
+			Roles:        viewCfg.Roles,
+			Tenants:      viewCfg.Tenants,
+			Public:       viewCfg.Public,
+			MatchClients: viewCfg.MatchClients,
+		}
+		if err := view.Validate(); err != nil {
+			return nil, fmt.Errorf("view %s: %v", view.Name, err)
+		}
+		views = append(views, view)
+	}
+
+	return views, nil
+}
+
+func runDns(ctx context.Context, env *Environment, cfg config.DnsConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("Validate: %v", err)
+	}
+
+	generate, err := generator.NewGenerator(env.Netbox, cfg.Out)
+	if err != nil {
+		return fmt.Errorf("NewGenerator: %v", err)
+	}
+
+	generate.SerialFormat, err = generator.ParseSerialFormat(cfg.SerialFormat)
+	if err != nil {
+		return fmt.Errorf("ParseSerialFormat: %v", err)
+	}
+
+	generate.ForwardZone = cfg.Forward
+	generate.ReverseZone = cfg.Reverse
+	generate.Zones = cfg.Zones
+	if cfg.ObjectURLs {
+		generate.BaseURL = env.BaseURL
+	}
+
+	generate.Views, err = views(cfg.Views)
+	if err != nil {
+		return fmt.Errorf("views: %v", err)
+	}
+
+	if cfg.Dnssec.Enabled {
+		generate.Dnssec, err = dnssec(cfg.Dnssec)
+		if err != nil {
+			return fmt.Errorf("dnssec: %v", err)
+		}
+	}
+
+	nameserver := generator.NameserverConfig{
+		Formats:       cfg.Nameserver.Formats,
+		ZoneDir:       cfg.Nameserver.ZoneDir,
+		Primaries:     cfg.Nameserver.Primaries,
+		AllowTransfer: cfg.Nameserver.AllowTransfer,
+		AlsoNotify:    cfg.Nameserver.AlsoNotify,
+		TsigKey:       cfg.Nameserver.TsigKey,
+	}
+	if err := nameserver.Validate(); err != nil {
+		return fmt.Errorf("nameserver: %v", err)
+	}
+
+	if cfg.Mode == config.DnsModeUpdate {
+		if generate.Dnssec != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: dnssec only signs zone files, zones are updated unsigned\n")
+		}
+
+		server, err := dnsServer(cfg.Update)
+		if err != nil {
+			return fmt.Errorf("dnsServer: %v", err)
+		}
+
+		if err := generate.UpdateDNS(ctx, server); err != nil {
+			return fmt.Errorf("UpdateDNS: %v", err)
+		}
+
+		return nil
+	}
+
+	if cfg.Mode == config.DnsModePowerDNS {
+		if generate.Dnssec != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: dnssec only signs zone files, zones are sent to powerdns unsigned\n")
+		}
+
+		server, err := powerDNS(cfg.PowerDNS)
+		if err != nil {
+			return fmt.Errorf("powerDNS: %v", err)
+		}
+
+		if err := generate.UpdatePowerDNS(ctx, server); err != nil {
+			return fmt.Errorf("UpdatePowerDNS: %v", err)
+		}
+
+		return nil
+	}
+
+	if err := generate.ReverseDNS(ctx, cfg.Serial); err != nil {
+		return fmt.Errorf("ReverseDNS: %v", err)
+	}
+
+	if err := generate.ForwardDNS(ctx, cfg.Serial); err != nil {
+		return fmt.Errorf("ForwardDNS: %v", err)
+	}
+
+	if err := generate.NameserverConfig(ctx, nameserver); err != nil {
+		return fmt.Errorf("NameserverConfig: %v", err)
+	}
+
+	return nil
+}
+
+func runAnsible(ctx context.Context, env *Environment, out string) error {
+	generate, err := generator.NewGenerator(env.Netbox, out)
+	if err != nil {
+		return fmt.Errorf("NewGenerator: %v", err)
+	}
+	generate.Filters = env.Config.Generators.Ansible.Filters
+
+	if err := generate.AnsibleInventory(ctx); err != nil {
+		return fmt.Errorf("AnsibleInventory: %v", err)
+	}
+
+	if err := generate.AnsibleGroupVars(ctx); err != nil {
+		return fmt.Errorf("AnsibleGroupVars: %v", err)
+	}
+
+	if err := generate.AnsibleHostVars(ctx); err != nil {
+		return fmt.Errorf("AnsibleHostVars: %v", err)
+	}
+
+	return nil
+}
+
+func runIcinga2(ctx context.Context, env *Environment, out string) error {
+	generate, err := generator.NewGenerator(env.Netbox, out)
+	if err != nil {
+		return fmt.Errorf("NewGenerator: %v", err)
+	}
+	generate.Filters = env.Config.Generators.Icinga2.Filters
+
+	if err := generate.Icinga2Config(ctx); err != nil {
+		return fmt.Errorf("Icinga2Config: %v", err)
+	}
+
+	return nil
+}
+
+func runRundeck(ctx context.Context, env *Environment, out string) error {
+	generate, err := generator.NewGenerator(env.Netbox, out)
+	if err != nil {
+		return fmt.Errorf("NewGenerator: %v", err)
+	}
+	generate.Filters = env.Config.Generators.Rundeck.Filters
+
+	if err := generate.RundeckHosts(ctx); err != nil {
+		return fmt.Errorf("RundeckHosts: %v", err)
+	}
+
+	return nil
+}
+
+func runBackup(ctx context.Context, env *Environment, out string) error {
+	generate, err := generator.NewGenerator(env.Netbox, out)
+	if err != nil {
+		return fmt.Errorf("NewGenerator: %v", err)
+	}
+	generate.Filters = env.Config.Generators.Backup.Filters
+
+	if err := generate.BackupHosts(ctx); err != nil {
+		return fmt.Errorf("BackupHosts: %v", err)
+	}
+
+	return nil
+}
+
+func runLocalDns(ctx context.Context, env *Environment, cfg config.LocalDnsConfig) error {
+	dnsCfg := env.Config.Generators.Dns
+
+	generate, err := generator.NewGenerator(env.Netbox, cfg.Out)
+	if err != nil {
+		return fmt.Errorf("NewGenerator: %v", err)
+	}
+
+	generate.ForwardZone = dnsCfg.Forward
+	generate.ReverseZone = dnsCfg.Reverse
+	generate.Zones = dnsCfg.Zones
+	if dnsCfg.ObjectURLs {
+		generate.BaseURL = env.BaseURL
+	}
+
+	generate.Views, err = views(dnsCfg.Views)
+	if err != nil {
+		return fmt.Errorf("views: %v", err)
+	}
+
+	if err := generate.LocalDNS(ctx, cfg.Formats); err != nil {
+		return fmt.Errorf("LocalDNS: %v", err)
+	}
+
+	return nil
+}
+
+func dnsCommand() *Command {
+	flags := flag.NewFlagSet("dns", flag.ExitOnError)
+	out := flags.String("out", "", "Where to store output")
+	serial := flags.String("serial", "", "Serial number to use for dns zones, managed automatically if empty")
+	serialFormat := flags.String("serialformat", "", "Format of automatic serials (date or unix)")
+	mode := flags.String("mode", "", "Write zone files (files), send dynamic updates (update) or use the PowerDNS api (powerdns)")
+	server := flags.String("server", "", "Nameserver receiving dynamic updates in update mode")
+
+	return &Command{
+		Name:        "dns",
+		Description: "Generate forward and reverse dns zones",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Prefixes,
+			netboxclient.IpAddresses,
+			netboxclient.ConfigContexts,
+			netboxclient.Services,
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+		},
+		Run: func(ctx context.Context, env *Environment) error {
+			cfg := env.Config.Generators.Dns
+			cfg.Out = valueOr(*out, cfg.Out)
+			cfg.Serial = valueOr(*serial, cfg.Serial)
+			cfg.SerialFormat = valueOr(*serialFormat, cfg.SerialFormat)
+			cfg.Mode = valueOr(*mode, cfg.Mode)
+			cfg.Update.Server = valueOr(*server, cfg.Update.Server)
+
+			return runDns(ctx, env, cfg)
+		},
+	}
+}
+
+func dnsServeCommand() *Command {
+	flags := flag.NewFlagSet("dns serve", flag.ExitOnError)
+	listen := flags.String("listen", "", "Address to answer queries on (default from config)")
+	refresh := flags.Duration("refresh", 0, "Interval at which the zones are rebuilt from NetBox (default from config)")
+	serialFormat := flags.String("serialformat", "", "Format of serials (date or unix)")
+
+	return &Command{
+		Name:        "dns serve",
+		Description: "Serve forward and reverse dns zones as an authoritative nameserver",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Prefixes,
+			netboxclient.IpAddresses,
+			netboxclient.ConfigContexts,
+			netboxclient.Services,
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+		},
+		Daemon: true,
+		Run: func(ctx context.Context, env *Environment) error {
+			cfg := env.Config.Generators.Dns
+			cfg.Serve.Listen = valueOr(*listen, cfg.Serve.Listen)
+			if *refresh > 0 {
+				cfg.Serve.Refresh = *refresh
+			}
+
+			// The built-in nameserver serves every address to every
+			// client, which would publish the zones of private views
+			if len(cfg.Views) > 0 {
+				return fmt.Errorf("views are not supported, use the dns command")
+			}
+
+			generate, err := generator.NewGenerator(env.Netbox, "")
+			if err != nil {
+				return fmt.Errorf("NewGenerator: %v", err)
+			}
+
+			generate.SerialFormat, err = generator.ParseSerialFormat(valueOr(*serialFormat, cfg.SerialFormat))
+			if err != nil {
+				return fmt.Errorf("ParseSerialFormat: %v", err)
+			}
+
+			generate.ForwardZone = cfg.Forward
+			generate.ReverseZone = cfg.Reverse
+			generate.Zones = cfg.Zones
+			if cfg.ObjectURLs {
+				generate.BaseURL = env.BaseURL
+			}
+
+			server, err := authServer(cfg.Serve)
+			if err != nil {
+				return fmt.Errorf("authServer: %v", err)
+			}
+
+			// Date serials restart at YYYYMMDD00, which is lower than
+			// the serial of the secondaries after a change on the same
+			// day, unless they are kept in a state file
+			server.StateFile = cfg.Serve.StateFile
+			if server.StateFile == "" && cfg.Out != "" {
+				server.StateFile = filepath.Join(cfg.Out, "serve.serials")
+			}
+			if server.StateFile == "" && generate.SerialFormat == generator.SerialDate {
+				return fmt.Errorf("date serials need a state file, configure serve: state_file or out, or use unix serials")
+			}
+
+			fmt.Printf("[+] Listening on %s\n", server.Address)
+			if err := generate.ServeZones(ctx, server); err != nil {
+				return fmt.Errorf("ServeZones: %v", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+func localDnsCommand() *Command {
+	flags := flag.NewFlagSet("localdns", flag.ExitOnError)
+	out := flags.String("out", "", "Where to store output")
+	formats := flags.String("formats", "", "Comma separated formats to write (unbound, dnsmasq)")
+
+	return &Command{
+		Name:        "localdns",
+		Description: "Generate unbound and dnsmasq local data from the dns zones",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Prefixes,
+			netboxclient.IpAddresses,
+			netboxclient.ConfigContexts,
+			netboxclient.Services,
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+		},
+		Run: func(ctx context.Context, env *Environment) error {
+			cfg := env.Config.Generators.LocalDns
+			cfg.Out = valueOr(*out, cfg.Out)
+			if *formats != "" {
+				cfg.Formats = strings.Split(*formats, ",")
+			}
+
+			return runLocalDns(ctx, env, cfg)
+		},
+	}
+}
+
+func ansibleCommand() *Command {
+	flags := flag.NewFlagSet("ansible", flag.ExitOnError)
+	out := flags.String("out", "", "Where to store output")
+
+	return &Command{
+		Name:        "ansible",
+		Description: "Generate an ansible inventory with group and host vars",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+			netboxclient.ConfigContexts,
+		},
+		Run: func(ctx context.Context, env *Environment) error {
+			return runAnsible(ctx, env, valueOr(*out, env.Config.Generators.Ansible.Out))
+		},
+	}
+}
+
+func icinga2Command() *Command {
+	flags := flag.NewFlagSet("icinga2", flag.ExitOnError)
+	out := flags.String("out", "", "Where to store output")
+
+	return &Command{
+		Name:        "icinga2",
+		Description: "Generate icinga2 hosts, host groups and dependencies",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+			netboxclient.Tenants,
+		},
+		Run: func(ctx context.Context, env *Environment) error {
+			return runIcinga2(ctx, env, valueOr(*out, env.Config.Generators.Icinga2.Out))
+		},
+	}
+}
+
+func rundeckCommand() *Command {
+	flags := flag.NewFlagSet("rundeck", flag.ExitOnError)
+	out := flags.String("out", "", "Where to store output")
+
+	return &Command{
+		Name:        "rundeck",
+		Description: "Generate a rundeck resource file",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+		},
+		Run: func(ctx context.Context, env *Environment) error {
+			return runRundeck(ctx, env, valueOr(*out, env.Config.Generators.Rundeck.Out))
+		},
+	}
+}
+
+func backupCommand() *Command {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "", "Where to store output")
+
+	return &Command{
+		Name:        "backup",
+		Description: "Generate a list of hosts to backup",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+		},
+		Run: func(ctx context.Context, env *Environment) error {
+			return runBackup(ctx, env, valueOr(*out, env.Config.Generators.Backup.Out))
+		},
+	}
+}
+
+func allCommand() *Command {
+	flags := flag.NewFlagSet("all", flag.ExitOnError)
+	out := flags.String("out", "", "Directory below which the output of every generator is stored, instead of the configured directories")
+	serial := flags.String("serial", "", "Serial number to use for dns zones, managed automatically if empty")
+	serialFormat := flags.String("serialformat", "", "Format of automatic serials (date or unix)")
+	mode := flags.String("mode", "", "Write zone files (files), send dynamic updates (update) or use the PowerDNS api (powerdns)")
+	server := flags.String("server", "", "Nameserver receiving dynamic updates in update mode")
+
+	return &Command{
+		Name:        "all",
+		Description: "Run all generators",
+		Flags:       flags,
+		Collections: netboxclient.AllCollections,
+		Run: func(ctx context.Context, env *Environment) error {
+			generators := env.Config.Generators
+			if *out != "" {
+				generators.Dns.Out = filepath.Join(*out, "dns")
+				generators.LocalDns.Out = filepath.Join(*out, "localdns")
+				generators.Ansible.Out = filepath.Join(*out, "ansible")
+				generators.Icinga2.Out = filepath.Join(*out, "icinga2")
+				generators.Rundeck.Out = filepath.Join(*out, "rundeck")
+				generators.Backup.Out = filepath.Join(*out, "backup")
+			}
+
+			generators.Dns.Serial = valueOr(*serial, generators.Dns.Serial)
+			generators.Dns.SerialFormat = valueOr(*serialFormat, generators.Dns.SerialFormat)
+			generators.Dns.Mode = valueOr(*mode, generators.Dns.Mode)
+			generators.Dns.Update.Server = valueOr(*server, generators.Dns.Update.Server)
+
+			if err := runDns(ctx, env, generators.Dns); err != nil {
+				return err
+			}
+
+			if err := runLocalDns(ctx, env, generators.LocalDns); err != nil {
+				return err
+			}
+
+			if err := runAnsible(ctx, env, generators.Ansible.Out); err != nil {
+				return err
+			}
+
+			if err := runIcinga2(ctx, env, generators.Icinga2.Out); err != nil {
+				return err
+			}
+
+			if err := runRundeck(ctx, env, generators.Rundeck.Out); err != nil {
+				return err
+			}
+
+			return runBackup(ctx, env, generators.Backup.Out)
+		},
+	}
+}
+
+// reportWarnings prints warnings in the given format, and returns an
+// ExitError if there are any
+func reportWarnings(env *Environment, warnings []common.Warning, format string) error {
+	for idx := range warnings {
+		warnings[idx].URL = netboxclient.WebURL(env.BaseURL, warnings[idx].Object, warnings[idx].ID)
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(warnings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json.MarshalIndent: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+	case "text":
+		for _, warning := range warnings {
+			fmt.Printf("%s %s\n", warning, warning.URL)
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	if len(warnings) > 0 {
+		return &ExitError{Status: 2}
+	}
+
+	return nil
+}
+
+func lintCommand() *Command {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := flags.String("format", "text", "Report format to use (text or json)")
+
+	return &Command{
+		Name:        "lint",
+		Description: "Report NetBox objects which are skipped or break a generator",
+		Flags:       flags,
+		Collections: netboxclient.AllCollections,
+		Quiet:       true,
+		Run: func(ctx context.Context, env *Environment) error {
+			generate, err := generator.NewGenerator(env.Netbox, "")
+			if err != nil {
+				return fmt.Errorf("NewGenerator: %v", err)
+			}
+
+			warnings, err := generate.Lint(ctx)
+			if err != nil {
+				return fmt.Errorf("Lint: %v", err)
+			}
+
+			return reportWarnings(env, warnings, *format)
+		},
+	}
+}
+
+func dnscheckCommand() *Command {
+	flags := flag.NewFlagSet("dnscheck", flag.ExitOnError)
+	format := flags.String("format", "text", "Report format to use (text or json)")
+
+	return &Command{
+		Name:        "dnscheck",
+		Description: "Report addresses without forward confirmed reverse dns",
+		Flags:       flags,
+		Collections: []netboxclient.Collection{
+			netboxclient.Prefixes,
+			netboxclient.IpAddresses,
+			netboxclient.ConfigContexts,
+			netboxclient.Services,
+			netboxclient.Devices,
+			netboxclient.VirtualMachines,
+		},
+		Quiet: true,
+		Run: func(ctx context.Context, env *Environment) error {
+			generate, err := generator.NewGenerator(env.Netbox, "")
+			if err != nil {
+				return fmt.Errorf("NewGenerator: %v", err)
+			}
+
+			generate.ForwardZone = env.Config.Generators.Dns.Forward
+			generate.ReverseZone = env.Config.Generators.Dns.Reverse
+			generate.Zones = env.Config.Generators.Dns.Zones
+
+			generate.Views, err = views(env.Config.Generators.Dns.Views)
+			if err != nil {
+				return fmt.Errorf("views: %v", err)
+			}
+
+			warnings, err := generate.CheckDNS(ctx)
+			if err != nil {
+				return fmt.Errorf("CheckDNS: %v", err)
+			}
+
+			return reportWarnings(env, warnings, *format)
+		},
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	httptransport "github.com/go-openapi/runtime/client"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/config"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <command> [command options]\n\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-10s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	defaults := config.Default()
+
+	configFile := flag.String("config", os.Getenv("NETBOX_CONFIG"), "Configuration file to use (NETBOX_CONFIG)")
+	netboxHost := flag.String("api", defaults.Netbox.Api, "Api host:port (NETBOX_HOST)")
+	netboxToken := flag.String("token", "", "Token to use (NETBOX_TOKEN)")
+	netboxTokenFile := flag.String("tokenfile", "", "File containing the token to use (NETBOX_TOKEN_FILE)")
+	netboxNoTLS := flag.Bool("notls", defaults.Netbox.NoTLS, "Set to disable TLS (NETBOX_NOTLS)")
+	netboxPageSize := flag.Int64("pagesize", defaults.Netbox.PageSize, "Number of results to request per page")
+	netboxTimeout := flag.Duration("timeout", defaults.Netbox.Timeout, "Maximum time to spend talking to the api")
+	netboxRetries := flag.Int("retries", defaults.Netbox.Retries, "Number of times to retry a failed api request")
+	netboxRetryMin := flag.Duration("retrymin", defaults.Netbox.RetryMin, "Initial time to wait before retrying")
+	netboxRetryMax := flag.Duration("retrymax", defaults.Netbox.RetryMax, "Maximum time to wait before retrying")
+	netboxConcurrency := flag.Int("concurrency", defaults.Netbox.Concurrency, "Number of collections to fetch in parallel")
+	netboxSnapshot := flag.String("snapshot", "", "Write all collections to this snapshot file")
+	netboxOffline := flag.String("offline", "", "Read all collections from this snapshot file")
+	filterTenants := flag.String("tenants", "", "Comma separated tenants to manage, prefix with ! to exclude (default from config)")
+	filterPlatforms := flag.String("platforms", "", "Comma separated platforms to manage, prefix with ! to exclude (default from config)")
+	filterStatuses := flag.String("statuses", "", "Comma separated statuses to manage, prefix with ! to exclude (default from config)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	// Commands can consist of two words, like dns serve
+	args := flag.Args()
+	cmd := findCommand(args[0])
+	if len(args) > 1 {
+		if subcmd := findCommand(args[0] + " " + args[1]); subcmd != nil {
+			cmd = subcmd
+			args = args[1:]
+		}
+	}
+	if cmd == nil {
+		fmt.Printf("ERROR: unknown command: %s\n", flag.Arg(0))
+		usage()
+		os.Exit(1)
+	}
+	cmd.Flags.Parse(args[1:])
+
+	// Settings are taken from the configuration file first, which are
+	// overridden by the environment, which are overridden by flags
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Printf("ERROR: config.Load: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = cfg.LoadEnv()
+	if err != nil {
+		fmt.Printf("ERROR: LoadEnv: %v\n", err)
+		os.Exit(1)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		var err error
+		switch f.Name {
+		case "api":
+			cfg.Netbox.Api = *netboxHost
+		case "token":
+			cfg.Netbox.Token = *netboxToken
+		case "tokenfile":
+			cfg.Netbox.Token = ""
+			cfg.Netbox.TokenFile = *netboxTokenFile
+		case "notls":
+			cfg.Netbox.NoTLS = *netboxNoTLS
+		case "pagesize":
+			cfg.Netbox.PageSize = *netboxPageSize
+		case "timeout":
+			cfg.Netbox.Timeout = *netboxTimeout
+		case "retries":
+			cfg.Netbox.Retries = *netboxRetries
+		case "retrymin":
+			cfg.Netbox.RetryMin = *netboxRetryMin
+		case "retrymax":
+			cfg.Netbox.RetryMax = *netboxRetryMax
+		case "concurrency":
+			cfg.Netbox.Concurrency = *netboxConcurrency
+		case "tenants":
+			cfg.Filters.Tenants, err = common.ParseFilter(*filterTenants)
+		case "platforms":
+			cfg.Filters.Platforms, err = common.ParseFilter(*filterPlatforms)
+		case "statuses":
+			cfg.Filters.Statuses, err = common.ParseFilter(*filterStatuses)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: -%s: %v\n", f.Name, err)
+			os.Exit(1)
+		}
+	})
+
+	http_proto := "https"
+	if cfg.Netbox.NoTLS {
+		// Printed to stderr, since stdout may contain json output
+		fmt.Fprintf(os.Stderr, "WARNING: disabling TLS!\n")
+		http_proto = "http"
+	}
+
+	var (
+		netbox         *netboxclient.NetboxClient
+		retryTransport *netboxclient.RetryTransport
+	)
+	if *netboxOffline != "" {
+		netbox, err = netboxclient.NewNetboxClientFromSnapshot(*netboxOffline)
+		if err != nil {
+			fmt.Printf("ERROR: NewNetboxClientFromSnapshot: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		token, err := cfg.GetToken()
+		if err != nil {
+			fmt.Printf("ERROR: GetToken: %v\n", err)
+			os.Exit(1)
+		}
+
+		transport := httptransport.New(cfg.Netbox.Api, client.DefaultBasePath, []string{http_proto})
+		retryTransport = netboxclient.NewRetryTransport(transport.Transport, cfg.Netbox.Retries, cfg.Netbox.RetryMin, cfg.Netbox.RetryMax)
+		transport.Transport = retryTransport
+
+		netbox, err = netboxclient.NewNetboxClient(
+			client.New(transport, nil),
+			common.NewTokenAuth(token),
+			cfg.Netbox.PageSize,
+		)
+		if err != nil {
+			fmt.Printf("ERROR: NewNetboxClient: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	netbox.SetFilters(cfg.Filters)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Netbox.Timeout)
+	defer cancel()
+
+	collections := cmd.Collections
+	if *netboxSnapshot != "" {
+		collections = netboxclient.AllCollections
+	}
+
+	err = netbox.Prefetch(ctx, cfg.Netbox.Concurrency, collections...)
+	if err != nil {
+		fmt.Printf("ERROR: Prefetch: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *netboxSnapshot != "" {
+		if err := netbox.WriteSnapshot(*netboxSnapshot); err != nil {
+			fmt.Printf("ERROR: WriteSnapshot: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	env := &Environment{
+		Netbox:  netbox,
+		Config:  cfg,
+		BaseURL: fmt.Sprintf("%s://%s", http_proto, cfg.Netbox.Api),
+	}
+
+	runCtx := ctx
+	if cmd.Daemon {
+		var stop context.CancelFunc
+		runCtx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	status := 0
+	if err := cmd.Run(runCtx, env); err != nil {
+		if exitErr, ok := err.(*ExitError); ok {
+			status = exitErr.Status
+		} else {
+			fmt.Printf("ERROR: %s: %v\n", cmd.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	if !cmd.Quiet {
+		for _, warning := range netbox.Warnings() {
+			fmt.Fprintf(os.Stderr, "WARNING: %s\n", warning)
+		}
+
+		if retryTransport != nil && retryTransport.Retries() > 0 {
+			fmt.Printf("[+] Retried %d api requests\n", retryTransport.Retries())
+		}
+	}
+
+	os.Exit(status)
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter decides which values of a single NetBox field are managed. A value
+// is allowed if it matches any of the Include patterns, or if Include is
+// empty, and does not match any of the Exclude patterns. Patterns use the
+// syntax of path.Match, so `centos*` matches both centos and centos-7.
+type Filter struct {
+	Include []string `yaml:"include" json:"include,omitempty"`
+	Exclude []string `yaml:"exclude" json:"exclude,omitempty"`
+}
+
+// Filters contains the filters for the tenant, platform and status of an
+// object
+type Filters struct {
+	Tenants   Filter `yaml:"tenants" json:"tenants"`
+	Platforms Filter `yaml:"platforms" json:"platforms"`
+	Statuses  Filter `yaml:"statuses" json:"statuses"`
+}
+
+// DefaultFilters returns the filters used when none are configured
+func DefaultFilters() Filters {
+	return Filters{
+		Tenants:   Filter{Include: []string{"as65342"}},
+		Platforms: Filter{Include: []string{"centos", "coreos", "openbsd"}},
+		Statuses:  Filter{Include: []string{"Active"}},
+	}
+}
+
+// ParseFilter parses a comma separated list of patterns. Patterns starting
+// with a ! are added to the exclude list, all others to the include list.
+func ParseFilter(value string) (filter Filter, err error) {
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		if strings.HasPrefix(pattern, "!") {
+			filter.Exclude = append(filter.Exclude, pattern[1:])
+		} else {
+			filter.Include = append(filter.Include, pattern)
+		}
+	}
+
+	return filter, filter.Validate()
+}
+
+// UnmarshalYAML accepts either a plain list of patterns, which are used as
+// the include list, or a mapping with include and exclude lists
+func (f *Filter) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	include := []string{}
+	if err := unmarshal(&include); err == nil {
+		*f = Filter{Include: include}
+		return nil
+	}
+
+	type plain Filter
+	return unmarshal((*plain)(f))
+}
+
+// Validate returns an error if any of the patterns is malformed
+func (f Filter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match returns true if value is allowed by the filter
+func (f Filter) Match(value string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, value) {
+		return false
+	}
+
+	return !matchAny(f.Exclude, value)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error if any of the filters contains a malformed
+// pattern
+func (f Filters) Validate() error {
+	if err := f.Tenants.Validate(); err != nil {
+		return fmt.Errorf("tenants: %v", err)
+	}
+
+	if err := f.Platforms.Validate(); err != nil {
+		return fmt.Errorf("platforms: %v", err)
+	}
+
+	if err := f.Statuses.Validate(); err != nil {
+		return fmt.Errorf("statuses: %v", err)
+	}
+
+	return nil
+}
+
+// IsAllowedDevice returns true if the tenant, platform and status of device
+// are all allowed
+func (f Filters) IsAllowedDevice(device ManagedDevice) bool {
+	return f.Tenants.Match(device.Tenant) &&
+		f.Platforms.Match(device.Platform) &&
+		f.Statuses.Match(device.Status)
+}
@@ -0,0 +1,50 @@
+package common
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	filter := Filter{
+		Include: []string{"centos", "debian*"},
+		Exclude: []string{"debian-8"},
+	}
+
+	tests := map[string]bool{
+		"centos":   true,
+		"debian":   true,
+		"debian-9": true,
+		"debian-8": false,
+		"coreos":   false,
+		"":         false,
+	}
+	for value, expected := range tests {
+		if filter.Match(value) != expected {
+			t.Errorf("Match(%q): expected %v", value, expected)
+		}
+	}
+
+	if !(Filter{}).Match("anything") {
+		t.Errorf("Match: expected an empty filter to match everything")
+	}
+
+	if (Filter{Exclude: []string{"*"}}).Match("anything") {
+		t.Errorf("Match: expected exclude to take precedence")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("centos, debian*,!debian-8,")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+
+	if len(filter.Include) != 2 || filter.Include[0] != "centos" || filter.Include[1] != "debian*" {
+		t.Errorf("include: got %v", filter.Include)
+	}
+	if len(filter.Exclude) != 1 || filter.Exclude[0] != "debian-8" {
+		t.Errorf("exclude: got %v", filter.Exclude)
+	}
+
+	if _, err := ParseFilter("centos["); err == nil {
+		t.Errorf("ParseFilter: expected an error for an invalid pattern")
+	}
+}
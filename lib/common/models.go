@@ -1,8 +1,14 @@
 package common
 
-import "net"
+import (
+	"fmt"
+	"net"
+)
 
 type ManagedDevice struct {
+	// Object and ID refer to the device or virtual machine in NetBox
+	Object               string
+	ID                   int64
 	Name                 string
 	PrimaryIP            net.IP
 	PrimaryNet           *net.IPNet
@@ -16,11 +22,21 @@ type ManagedDevice struct {
 	Platform             string
 	Site                 string
 	Tenant               string
+	Status               string
 	Tags                 []string
 	Config               interface{}
 }
 
+func (d ManagedDevice) HasIPv4() bool {
+	return d.PrimaryIP4 != nil
+}
+
+func (d ManagedDevice) HasIPv6() bool {
+	return d.PrimaryIP6 != nil
+}
+
 type ConfigContext struct {
+	ID     int64
 	Name   string
 	Config interface{}
 }
@@ -39,8 +55,57 @@ type Gateway struct {
 }
 
 type IpAddress struct {
+	ID      int64
 	Address net.IP
 	Network *net.IPNet
 	Dns     string
 	Tenant  string
+	// Vrf is the name of the VRF of the address, empty for the global
+	// table
+	Vrf string
+	// Role is the role of the address in NetBox, like Secondary or VIP
+	Role string
+	// Host is the name of the device or virtual machine to which the
+	// address is assigned
+	Host         string
+	CustomFields map[string]interface{}
+}
+
+// Prefix is a prefix in NetBox, Vrf and Role are the name of its VRF and
+// the slug of its role, and are empty if they are not set
+type Prefix struct {
+	ID      int64
+	Network *net.IPNet
+	Vrf     string
+	Role    string
+	Tenant  string
+}
+
+// Service is a service offered by a device or virtual machine
+type Service struct {
+	ID       int64
+	Name     string
+	Protocol string
+	Port     int64
+	Host     string
+	// IpAddresses contains the ids of the addresses the service listens
+	// on, the service listens on all addresses of the host if it is empty
+	IpAddresses []int64
+}
+
+// Warning describes a NetBox object which could not be used, or could only
+// be partially used, because of missing or invalid data
+type Warning struct {
+	Object  string `json:"object"`
+	ID      int64  `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+	URL     string `json:"url,omitempty"`
+}
+
+func (w Warning) String() string {
+	if w.Name == "" {
+		return fmt.Sprintf("%s %d %s", w.Object, w.ID, w.Message)
+	}
+	return fmt.Sprintf("%s %d (%s) %s", w.Object, w.ID, w.Name, w.Message)
 }
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"net"
+)
+
+// privateNetworks contains the ranges which are not reachable from the
+// internet, and should not be published in public zones
+var privateNetworks = parseNetworks(
+	"10.0.0.0/8",     // RFC 1918
+	"172.16.0.0/12",  // RFC 1918
+	"192.168.0.0/16", // RFC 1918
+	"100.64.0.0/10",  // RFC 6598, carrier grade nat
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // RFC 3927, link local
+	"::1/128",        // loopback
+	"fc00::/7",       // RFC 4193, unique local
+	"fe80::/10",      // link local
+)
+
+func parseNetworks(values ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, value := range values {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsPrivateAddress returns true if ip is in a private, loopback or link
+// local range
+func IsPrivateAddress(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivateNetwork returns true if network overlaps with a private,
+// loopback or link local range
+func IsPrivateNetwork(network *net.IPNet) bool {
+	for _, private := range privateNetworks {
+		if private.Contains(network.IP) || network.Contains(private.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivate(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		private bool
+	}{
+		{"10.42.0.10/32", true},
+		{"172.31.255.1/32", true},
+		{"172.32.0.1/32", false},
+		{"192.0.2.10/32", false},
+		{"100.64.1.1/32", true},
+		{"fd00:42::1/128", true},
+		{"2001:db8:42::10/128", false},
+		{"192.168.0.0/24", true},
+		{"192.0.0.0/8", true},
+		{"198.51.100.0/24", false},
+		{"fc00::/6", true},
+	}
+
+	for _, test := range tests {
+		ip, network, err := net.ParseCIDR(test.prefix)
+		if err != nil {
+			t.Fatalf("net.ParseCIDR: %v", err)
+		}
+
+		if ones, bits := network.Mask.Size(); ones == bits {
+			if private := IsPrivateAddress(ip); private != test.private {
+				t.Errorf("IsPrivateAddress(%s): expected %v, got %v", ip, test.private, private)
+			}
+		}
+
+		if private := IsPrivateNetwork(network); private != test.private {
+			t.Errorf("IsPrivateNetwork(%s): expected %v, got %v", network, test.private, private)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ReverseZoneNetworks splits network into the networks for which a reverse
+// zone can be generated. IPv4 zones are aligned on octets, so a /20 is split
+// into 16 /24 zones, except for networks longer than /24 which get a
+// classless zone as described in RFC 2317. IPv6 zones are aligned on nibbles.
+func ReverseZoneNetworks(network *net.IPNet) []*net.IPNet {
+	ones, bits := network.Mask.Size()
+
+	step := 4
+	ip := network.IP.Mask(network.Mask)
+	if bits == 32 {
+		if ones > 24 {
+			return []*net.IPNet{{IP: ip, Mask: network.Mask}}
+		}
+		step = 8
+	}
+
+	aligned := ((ones + step - 1) / step) * step
+	mask := net.CIDRMask(aligned, bits)
+
+	networks := []*net.IPNet{}
+	for i := 0; i < 1<<uint(aligned-ones); i++ {
+		networks = append(networks, &net.IPNet{IP: ip, Mask: mask})
+		ip = nextNetwork(ip, aligned)
+	}
+
+	return networks
+}
+
+// nextNetwork returns the address of the network of size prefixLen which
+// follows the network at ip
+func nextNetwork(ip net.IP, prefixLen int) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	idx := (prefixLen - 1) / 8
+	carry := 1 << uint(7-(prefixLen-1)%8)
+	for ; idx >= 0 && carry > 0; idx-- {
+		sum := int(next[idx]) + carry
+		next[idx] = byte(sum)
+		carry = sum >> 8
+	}
+
+	return next
+}
+
+// nibbles returns the hexadecimal digits of an IPv6 address
+func nibbles(ip net.IP) []string {
+	result := []string{}
+	for _, b := range ip.To16() {
+		result = append(result, fmt.Sprintf("%x", b>>4), fmt.Sprintf("%x", b&0xf))
+	}
+	return result
+}
+
+// reverseLabels returns labels in reverse order, joined by dots
+func reverseLabels(labels []string) string {
+	result := []string{}
+	for idx := len(labels) - 1; idx >= 0; idx-- {
+		result = append(result, labels[idx])
+	}
+	return strings.Join(result, ".")
+}
+
+// ToDnsZoneName returns the name of the reverse zone for network, which
+// needs to be one of the networks returned by ReverseZoneNetworks. The
+// classless zones of RFC 2317 are named <first address>-<prefix length>,
+// eg 64-26.2.0.192.in-addr.arpa.
+func ToDnsZoneName(network *net.IPNet) string {
+	ones, bits := network.Mask.Size()
+
+	if bits == 32 {
+		i := network.IP.To4()
+		labels := []string{}
+		for idx := 0; idx < ones/8 && idx < 3; idx++ {
+			labels = append(labels, fmt.Sprintf("%d", i[idx]))
+		}
+		if ones > 24 {
+			labels = append(labels, fmt.Sprintf("%d-%d", i[3], ones))
+		}
+		return strings.TrimPrefix(reverseLabels(labels)+".in-addr.arpa", ".")
+	}
+
+	return strings.TrimPrefix(reverseLabels(nibbles(network.IP)[:ones/4])+".ip6.arpa", ".")
+}
+
+// ToPtrName returns the owner name of the PTR record for ip, relative to
+// the reverse zone of network
+func ToPtrName(ip net.IP, network *net.IPNet) string {
+	ones, bits := network.Mask.Size()
+
+	if bits == 32 {
+		i := ip.To4()
+		if ones > 24 {
+			return fmt.Sprintf("%d", i[3])
+		}
+
+		labels := []string{}
+		for idx := ones / 8; idx < 4; idx++ {
+			labels = append(labels, fmt.Sprintf("%d", i[idx]))
+		}
+		return reverseLabels(labels)
+	}
+
+	return reverseLabels(nibbles(ip)[ones/4:])
+}
+
+// PtrAddress returns the address of which name is the fully qualified PTR
+// name. The labels of the classless zones of RFC 2317 are skipped, so
+// 70.64-26.2.0.192.in-addr.arpa is the name of 192.0.2.70.
+func PtrAddress(name string) (net.IP, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	var labels []string
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		for _, label := range strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".") {
+			if !strings.Contains(label, "-") {
+				labels = append(labels, label)
+			}
+		}
+		if len(labels) != 4 {
+			return nil, false
+		}
+		ip := net.ParseIP(reverseLabels(labels)).To4()
+		return ip, ip != nil
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		labels = strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(labels) != 32 {
+			return nil, false
+		}
+		digits := strings.Replace(reverseLabels(labels), ".", "", -1)
+		groups := []string{}
+		for idx := 0; idx+4 <= len(digits); idx += 4 {
+			groups = append(groups, digits[idx:idx+4])
+		}
+		ip := net.ParseIP(strings.Join(groups, ":"))
+		return ip, ip != nil && len(digits) == 32
+	}
+
+	return nil, false
+}
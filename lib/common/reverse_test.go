@@ -0,0 +1,99 @@
+package common
+
+import (
+	"net"
+	"testing"
+)
+
+func TestReverseZones(t *testing.T) {
+	tests := []struct {
+		prefix string
+		zones  []string
+	}{
+		{"10.0.0.0/8", []string{"10.in-addr.arpa"}},
+		{"10.42.0.0/16", []string{"42.10.in-addr.arpa"}},
+		{"192.0.2.0/24", []string{"2.0.192.in-addr.arpa"}},
+		{"192.0.2.64/26", []string{"64-26.2.0.192.in-addr.arpa"}},
+		{"10.42.0.0/23", []string{"0.42.10.in-addr.arpa", "1.42.10.in-addr.arpa"}},
+		{"10.0.0.0/15", []string{"0.10.in-addr.arpa", "1.10.in-addr.arpa"}},
+		{"2001:db8:42::/64", []string{"0.0.0.0.2.4.0.0.8.b.d.0.1.0.0.2.ip6.arpa"}},
+		{"2001:db8::/32", []string{"8.b.d.0.1.0.0.2.ip6.arpa"}},
+		{"2001:db8:4200::/40", []string{"2.4.8.b.d.0.1.0.0.2.ip6.arpa"}},
+		{"2001:db8:42fe::/47", []string{"e.f.2.4.8.b.d.0.1.0.0.2.ip6.arpa", "f.f.2.4.8.b.d.0.1.0.0.2.ip6.arpa"}},
+	}
+
+	for _, test := range tests {
+		_, network, err := net.ParseCIDR(test.prefix)
+		if err != nil {
+			t.Fatalf("net.ParseCIDR: %v", err)
+		}
+
+		zones := ReverseZoneNetworks(network)
+		if len(zones) != len(test.zones) {
+			t.Errorf("%s: expected %d zones, got %d", test.prefix, len(test.zones), len(zones))
+			continue
+		}
+
+		for idx, zone := range zones {
+			if name := ToDnsZoneName(zone); name != test.zones[idx] {
+				t.Errorf("%s: expected zone %s, got %s", test.prefix, test.zones[idx], name)
+			}
+		}
+	}
+}
+
+func TestToPtrName(t *testing.T) {
+	tests := []struct {
+		address string
+		zone    string
+		name    string
+	}{
+		{"10.42.1.2", "10.0.0.0/8", "2.1.42"},
+		{"10.42.1.2", "10.42.0.0/16", "2.1"},
+		{"192.0.2.70", "192.0.2.0/24", "70"},
+		{"192.0.2.70", "192.0.2.64/26", "70"},
+		{"2001:db8:42::1", "2001:db8:42::/64", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0"},
+		{"2001:db8:42::1", "2001:db8:42::/56", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0"},
+	}
+
+	for _, test := range tests {
+		_, network, err := net.ParseCIDR(test.zone)
+		if err != nil {
+			t.Fatalf("net.ParseCIDR: %v", err)
+		}
+
+		if name := ToPtrName(net.ParseIP(test.address), network); name != test.name {
+			t.Errorf("%s in %s: expected %s, got %s", test.address, test.zone, test.name, name)
+		}
+	}
+}
+
+func TestPtrAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+	}{
+		{"10.2.0.192.in-addr.arpa.", "192.0.2.10"},
+		{"70.64-26.2.0.192.in-addr.arpa", "192.0.2.70"},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.2.4.0.0.8.B.D.0.1.0.0.2.ip6.arpa.", "2001:db8:42::1"},
+		{"2.0.192.in-addr.arpa.", ""},
+		{"300.2.0.192.in-addr.arpa.", ""},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.2.4.0.0.8.b.d.0.1.0.0.ip6.arpa.", ""},
+		{"12.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.2.4.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", ""},
+		{"www.example.org.", ""},
+	}
+
+	for _, test := range tests {
+		ip, ok := PtrAddress(test.name)
+		if test.address == "" {
+			if ok {
+				t.Errorf("%s: expected no address, got %s", test.name, ip)
+			}
+			continue
+		}
+
+		if !ok || !ip.Equal(net.ParseIP(test.address)) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.address, ip)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// hostName matches host names, with or without the trailing dot
+var hostName = regexp.MustCompile(`^([a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9])?\.?$`)
+
+// SOA contains the fields of the SOA record of a zone. All timers are in
+// seconds.
+type SOA struct {
+	PrimaryNS  string `yaml:"primary_ns" json:"primary_ns"`
+	Hostmaster string `yaml:"hostmaster" json:"hostmaster"`
+	Refresh    int    `yaml:"refresh" json:"refresh"`
+	Retry      int    `yaml:"retry" json:"retry"`
+	Expire     int    `yaml:"expire" json:"expire"`
+	Minimum    int    `yaml:"minimum" json:"minimum"`
+}
+
+type MailExchanger struct {
+	Preference int    `yaml:"preference" json:"preference"`
+	Host       string `yaml:"host" json:"host"`
+}
+
+// CAA is a CAA record at the apex of a zone, see RFC 8659
+type CAA struct {
+	Flags int    `yaml:"flags" json:"flags"`
+	Tag   string `yaml:"tag" json:"tag"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// ZoneSettings contains the data of a zone apart from its records. Fields
+// which are empty are taken from the defaults, see Merge.
+type ZoneSettings struct {
+	TTL            int             `yaml:"ttl" json:"ttl"`
+	SOA            SOA             `yaml:"soa" json:"soa"`
+	NameServers    []string        `yaml:"ns" json:"ns"`
+	MailExchangers []MailExchanger `yaml:"mx" json:"mx"`
+	CAA            []CAA           `yaml:"caa" json:"caa"`
+	// Wildcard is the target of the wildcard PTR record of reverse zones,
+	// which answers for addresses that are not in NetBox. Reverse zones
+	// have no wildcard if it is empty.
+	Wildcard string `yaml:"wildcard" json:"wildcard"`
+}
+
+// DefaultReverseZoneSettings returns the settings used for reverse zones
+// when none are configured
+func DefaultReverseZoneSettings() ZoneSettings {
+	return ZoneSettings{
+		TTL: 60,
+		SOA: SOA{
+			PrimaryNS:  "master.as65342.net.",
+			Hostmaster: "hostmaster.as65342.net.",
+			Refresh:    3600,
+			Retry:      7200,
+			Expire:     2419200,
+			Minimum:    60,
+		},
+		NameServers: []string{"ns.as65342.net."},
+		Wildcard:    "unallocated.as65342.net.",
+	}
+}
+
+// DefaultForwardZoneSettings returns the settings used for forward zones
+// when none are configured
+func DefaultForwardZoneSettings() ZoneSettings {
+	settings := DefaultReverseZoneSettings()
+	settings.Wildcard = ""
+	settings.MailExchangers = []MailExchanger{
+		{Preference: 10, Host: "mail.as65342.net."},
+	}
+	return settings
+}
+
+// Merge returns the settings in s, with every field which is set in
+// override replaced by the value from override
+func (s ZoneSettings) Merge(override ZoneSettings) ZoneSettings {
+	result := s
+
+	if override.TTL != 0 {
+		result.TTL = override.TTL
+	}
+	if override.SOA.PrimaryNS != "" {
+		result.SOA.PrimaryNS = override.SOA.PrimaryNS
+	}
+	if override.SOA.Hostmaster != "" {
+		result.SOA.Hostmaster = override.SOA.Hostmaster
+	}
+	if override.SOA.Refresh != 0 {
+		result.SOA.Refresh = override.SOA.Refresh
+	}
+	if override.SOA.Retry != 0 {
+		result.SOA.Retry = override.SOA.Retry
+	}
+	if override.SOA.Expire != 0 {
+		result.SOA.Expire = override.SOA.Expire
+	}
+	if override.SOA.Minimum != 0 {
+		result.SOA.Minimum = override.SOA.Minimum
+	}
+	if override.NameServers != nil {
+		result.NameServers = override.NameServers
+	}
+	if override.MailExchangers != nil {
+		result.MailExchangers = override.MailExchangers
+	}
+	if override.CAA != nil {
+		result.CAA = override.CAA
+	}
+	if override.Wildcard != "" {
+		result.Wildcard = override.Wildcard
+	}
+
+	return result
+}
+
+// Normalize returns the settings with all host names made fully qualified,
+// and the hostmaster converted to the mailbox format used by the SOA record
+// if it is given as an email address
+func (s ZoneSettings) Normalize() ZoneSettings {
+	result := s
+
+	result.SOA.PrimaryNS = ToFqdn(s.SOA.PrimaryNS)
+	result.SOA.Hostmaster = ToFqdn(strings.Replace(s.SOA.Hostmaster, "@", ".", 1))
+	if s.Wildcard != "" {
+		result.Wildcard = ToFqdn(s.Wildcard)
+	}
+
+	result.NameServers = []string{}
+	for _, ns := range s.NameServers {
+		result.NameServers = append(result.NameServers, ToFqdn(ns))
+	}
+
+	result.MailExchangers = []MailExchanger{}
+	for _, mx := range s.MailExchangers {
+		result.MailExchangers = append(result.MailExchangers, MailExchanger{
+			Preference: mx.Preference,
+			Host:       ToFqdn(mx.Host),
+		})
+	}
+
+	return result
+}
+
+// Validate returns an error if the settings cannot be used for a zone
+func (s ZoneSettings) Validate() error {
+	if s.TTL < 0 || s.SOA.Refresh < 0 || s.SOA.Retry < 0 || s.SOA.Expire < 0 || s.SOA.Minimum < 0 {
+		return fmt.Errorf("ttl and soa timers cannot be negative")
+	}
+
+	if s.SOA.PrimaryNS == "" {
+		return fmt.Errorf("no primary name server")
+	}
+
+	if s.SOA.Hostmaster == "" {
+		return fmt.Errorf("no hostmaster")
+	}
+
+	if len(s.NameServers) == 0 {
+		return fmt.Errorf("no name servers")
+	}
+
+	for _, mx := range s.MailExchangers {
+		if mx.Host == "" || mx.Preference < 0 || mx.Preference > 65535 {
+			return fmt.Errorf("invalid mail exchanger: %d %s", mx.Preference, mx.Host)
+		}
+	}
+
+	for _, caa := range s.CAA {
+		switch {
+		case caa.Flags < 0 || caa.Flags > 255:
+			return fmt.Errorf("invalid caa flags: %d", caa.Flags)
+		case caa.Tag != "issue" && caa.Tag != "issuewild" && caa.Tag != "iodef":
+			return fmt.Errorf("invalid caa tag: %s", caa.Tag)
+		case strings.ContainsAny(caa.Value, "\"\\\n"):
+			return fmt.Errorf("invalid caa value: %s", caa.Value)
+		}
+	}
+
+	if s.Wildcard != "" && !hostName.MatchString(s.Wildcard) {
+		return fmt.Errorf("invalid wildcard: %s", s.Wildcard)
+	}
+
+	return nil
+}
@@ -0,0 +1,481 @@
+// Package config contains the configuration file describing a deployment,
+// which holds the NetBox connection settings, the objects to manage and the
+// settings for every generator.
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+type NetboxConfig struct {
+	Api         string        `yaml:"api"`
+	NoTLS       bool          `yaml:"notls"`
+	Token       string        `yaml:"token"`
+	TokenFile   string        `yaml:"token_file"`
+	PageSize    int64         `yaml:"page_size"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Retries     int           `yaml:"retries"`
+	RetryMin    time.Duration `yaml:"retry_min"`
+	RetryMax    time.Duration `yaml:"retry_max"`
+	Concurrency int           `yaml:"concurrency"`
+}
+
+type OutputConfig struct {
+	Out     string         `yaml:"out"`
+	Filters common.Filters `yaml:"filters"`
+}
+
+// TsigConfig contains the key used to sign zone transfers, updates and
+// notifies
+type TsigConfig struct {
+	TsigName       string `yaml:"tsig_name"`
+	TsigAlgorithm  string `yaml:"tsig_algorithm"`
+	TsigSecret     string `yaml:"tsig_secret"`
+	TsigSecretFile string `yaml:"tsig_secret_file"`
+}
+
+// DnsUpdateConfig describes the primary nameserver which receives dynamic
+// updates when the dns generator runs in update mode
+type DnsUpdateConfig struct {
+	TsigConfig `yaml:",inline"`
+	Server     string        `yaml:"server"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// DnsPowerDNSConfig describes the PowerDNS server whose zones are managed
+// using its HTTP api when the dns generator runs in powerdns mode
+type DnsPowerDNSConfig struct {
+	URL        string        `yaml:"url"`
+	ServerID   string        `yaml:"server_id"`
+	APIKey     string        `yaml:"api_key"`
+	APIKeyFile string        `yaml:"api_key_file"`
+	Kind       string        `yaml:"kind"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// DnsServeConfig contains the settings of the built-in authoritative
+// nameserver
+type DnsServeConfig struct {
+	TsigConfig    `yaml:",inline"`
+	Listen        string        `yaml:"listen"`
+	Refresh       time.Duration `yaml:"refresh"`
+	Timeout       time.Duration `yaml:"timeout"`
+	AllowTransfer []string      `yaml:"allow_transfer"`
+	Notify        []string      `yaml:"notify"`
+	StateFile     string        `yaml:"state_file"`
+}
+
+// DnsNameserverConfig describes the zone configuration which is written
+// for the nameservers serving the zone files
+type DnsNameserverConfig struct {
+	Formats       []string `yaml:"formats"`
+	ZoneDir       string   `yaml:"zone_dir"`
+	Primaries     []string `yaml:"primaries"`
+	AllowTransfer []string `yaml:"allow_transfer"`
+	AlsoNotify    []string `yaml:"also_notify"`
+	TsigKey       string   `yaml:"tsig_key"`
+}
+
+// DnssecConfig contains the settings used to sign the zone files
+type DnssecConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	KeyDir          string        `yaml:"key_dir"`
+	Algorithm       string        `yaml:"algorithm"`
+	NSEC3           bool          `yaml:"nsec3"`
+	NSEC3Iterations uint16        `yaml:"nsec3_iterations"`
+	NSEC3Salt       string        `yaml:"nsec3_salt"`
+	Validity        time.Duration `yaml:"validity"`
+	Refresh         time.Duration `yaml:"refresh"`
+	Zones           common.Filter `yaml:"zones"`
+}
+
+const (
+	// DnsModeFiles writes zone files
+	DnsModeFiles = "files"
+	// DnsModeUpdate sends the zones to a nameserver using dynamic updates
+	DnsModeUpdate = "update"
+	// DnsModePowerDNS manages the zones of a PowerDNS server using its
+	// HTTP api
+	DnsModePowerDNS = "powerdns"
+)
+
+// powerdnsKinds are the kinds of zones which can be created on PowerDNS
+var powerdnsKinds = map[string]bool{
+	"Native": true,
+	"Master": true,
+	"Slave":  true,
+}
+
+type DnsConfig struct {
+	Mode         string                         `yaml:"mode"`
+	Out          string                         `yaml:"out"`
+	Serial       string                         `yaml:"serial"`
+	SerialFormat string                         `yaml:"serial_format"`
+	Forward      common.ZoneSettings            `yaml:"forward"`
+	Reverse      common.ZoneSettings            `yaml:"reverse"`
+	Zones        map[string]common.ZoneSettings `yaml:"zones"`
+	Update       DnsUpdateConfig                `yaml:"update"`
+	PowerDNS     DnsPowerDNSConfig              `yaml:"powerdns"`
+	Serve        DnsServeConfig                 `yaml:"serve"`
+	Nameserver   DnsNameserverConfig            `yaml:"nameserver"`
+	Dnssec       DnssecConfig                   `yaml:"dnssec"`
+	ObjectURLs   bool                           `yaml:"object_urls"`
+	Views        []DnsViewConfig                `yaml:"views"`
+}
+
+// DnsViewConfig selects the addresses and prefixes of a view using their
+// VRF, the role of their prefix and their tenant
+type DnsViewConfig struct {
+	Name         string        `yaml:"name"`
+	Vrfs         common.Filter `yaml:"vrfs"`
+	Roles        common.Filter `yaml:"roles"`
+	Tenants      common.Filter `yaml:"tenants"`
+	Public       bool          `yaml:"public"`
+	MatchClients []string      `yaml:"match_clients"`
+}
+
+// LocalDnsConfig contains the formats in which the records of the dns zones
+// are written as local data for resolvers, which use the zone settings and
+// views of the dns generator
+type LocalDnsConfig struct {
+	Out     string   `yaml:"out"`
+	Formats []string `yaml:"formats"`
+}
+
+type GeneratorsConfig struct {
+	Dns      DnsConfig      `yaml:"dns"`
+	LocalDns LocalDnsConfig `yaml:"localdns"`
+	Ansible  OutputConfig   `yaml:"ansible"`
+	Icinga2  OutputConfig   `yaml:"icinga2"`
+	Rundeck  OutputConfig   `yaml:"rundeck"`
+	Backup   OutputConfig   `yaml:"backup"`
+}
+
+type Config struct {
+	Netbox     NetboxConfig     `yaml:"netbox"`
+	Filters    common.Filters   `yaml:"filters"`
+	Generators GeneratorsConfig `yaml:"generators"`
+}
+
+// Default returns the configuration used when no configuration file is
+// given
+func Default() *Config {
+	return &Config{
+		Netbox: NetboxConfig{
+			Api:         "localhost:443",
+			PageSize:    1000,
+			Timeout:     5 * time.Minute,
+			Retries:     3,
+			RetryMin:    1 * time.Second,
+			RetryMax:    30 * time.Second,
+			Concurrency: 4,
+		},
+		Filters: common.DefaultFilters(),
+		Generators: GeneratorsConfig{
+			Dns: DnsConfig{
+				Mode:   DnsModeFiles,
+				Update: DnsUpdateConfig{Timeout: 10 * time.Second},
+				PowerDNS: DnsPowerDNSConfig{
+					ServerID: "localhost",
+					Kind:     "Native",
+					Timeout:  10 * time.Second,
+				},
+				Serve: DnsServeConfig{
+					Listen:        ":53",
+					Refresh:       5 * time.Minute,
+					Timeout:       5 * time.Second,
+					AllowTransfer: []string{"127.0.0.1", "::1"},
+				},
+				Dnssec: DnssecConfig{
+					KeyDir:    "keys",
+					Algorithm: "ecdsap256sha256",
+					Validity:  30 * 24 * time.Hour,
+					Refresh:   7 * 24 * time.Hour,
+				},
+				Forward: common.DefaultForwardZoneSettings(),
+				Reverse: common.DefaultReverseZoneSettings(),
+			},
+			LocalDns: LocalDnsConfig{
+				Formats: []string{"unbound", "dnsmasq"},
+			},
+			Ansible: OutputConfig{
+				Filters: common.Filters{
+					Platforms: common.Filter{Include: []string{"centos", "openbsd"}},
+				},
+			},
+		},
+	}
+}
+
+// Load reads the configuration file fname on top of the defaults. Only the
+// defaults are returned if fname is empty.
+func Load(fname string) (*Config, error) {
+	cfg := Default()
+	if fname == "" {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	err = yaml.UnmarshalStrict(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("yaml.UnmarshalStrict: %v", err)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("Validate: %v", err)
+	}
+
+	return cfg, nil
+}
+
+// Validate returns an error if any of the filters or the dns mode is
+// invalid
+func (c *Config) Validate() error {
+	if err := c.Filters.Validate(); err != nil {
+		return fmt.Errorf("filters: %v", err)
+	}
+
+	if err := c.Generators.Dns.Validate(); err != nil {
+		return fmt.Errorf("generators: dns: %v", err)
+	}
+
+	outputs := map[string]OutputConfig{
+		"ansible": c.Generators.Ansible,
+		"icinga2": c.Generators.Icinga2,
+		"rundeck": c.Generators.Rundeck,
+		"backup":  c.Generators.Backup,
+	}
+	for name, output := range outputs {
+		if err := output.Filters.Validate(); err != nil {
+			return fmt.Errorf("generators: %s: filters: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate returns an error if the mode is unknown, if update or powerdns
+// mode is used without a server, or if the settings of the nameserver or of
+// dnssec are invalid
+func (c DnsConfig) Validate() error {
+	switch c.Mode {
+	case "", DnsModeFiles:
+	case DnsModeUpdate:
+		if c.Update.Server == "" {
+			return fmt.Errorf("update: no server configured")
+		}
+	case DnsModePowerDNS:
+		if c.PowerDNS.URL == "" {
+			return fmt.Errorf("powerdns: no url configured")
+		}
+	default:
+		return fmt.Errorf("unknown mode: %s", c.Mode)
+	}
+
+	if err := c.Update.TsigConfig.Validate(); err != nil {
+		return fmt.Errorf("update: %v", err)
+	}
+
+	if err := c.Serve.TsigConfig.Validate(); err != nil {
+		return fmt.Errorf("serve: %v", err)
+	}
+
+	if err := c.PowerDNS.Validate(); err != nil {
+		return fmt.Errorf("powerdns: %v", err)
+	}
+
+	if c.Serve.Refresh <= 0 {
+		return fmt.Errorf("serve: refresh needs to be positive")
+	}
+
+	if _, err := c.Serve.TransferNetworks(); err != nil {
+		return fmt.Errorf("serve: allow_transfer: %v", err)
+	}
+
+	if err := c.Dnssec.Validate(); err != nil {
+		return fmt.Errorf("dnssec: %v", err)
+	}
+
+	if len(c.Views) > 0 && c.Mode != "" && c.Mode != DnsModeFiles {
+		return fmt.Errorf("views are only supported in %s mode", DnsModeFiles)
+	}
+
+	seen := make(map[string]bool)
+	for idx, view := range c.Views {
+		if view.Name == "" {
+			return fmt.Errorf("views: view %d has no name", idx)
+		}
+		if seen[view.Name] {
+			return fmt.Errorf("views: duplicate view %s", view.Name)
+		}
+		seen[view.Name] = true
+	}
+
+	return nil
+}
+
+// Validate returns an error if signatures would be refreshed only after
+// they expire, or if the salt or the zone filter is invalid
+func (c DnssecConfig) Validate() error {
+	if c.Refresh <= 0 || c.Validity <= c.Refresh {
+		return fmt.Errorf("validity needs to be longer than refresh")
+	}
+
+	if _, err := hex.DecodeString(c.NSEC3Salt); err != nil {
+		return fmt.Errorf("nsec3_salt: %v", err)
+	}
+
+	if len(c.NSEC3Salt) > 2*255 {
+		return fmt.Errorf("nsec3_salt: longer than 255 bytes")
+	}
+
+	if err := c.Zones.Validate(); err != nil {
+		return fmt.Errorf("zones: %v", err)
+	}
+
+	return nil
+}
+
+// Validate returns an error if the secret is configured twice
+func (c TsigConfig) Validate() error {
+	if c.TsigSecret != "" && c.TsigSecretFile != "" {
+		return fmt.Errorf("tsig_secret and tsig_secret_file are mutually exclusive")
+	}
+	return nil
+}
+
+// Validate returns an error if the api key is configured twice or if the
+// kind of new zones is unknown
+func (c DnsPowerDNSConfig) Validate() error {
+	if c.APIKey != "" && c.APIKeyFile != "" {
+		return fmt.Errorf("api_key and api_key_file are mutually exclusive")
+	}
+	if !powerdnsKinds[c.Kind] {
+		return fmt.Errorf("unknown kind: %s", c.Kind)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout needs to be positive")
+	}
+	return nil
+}
+
+// TransferNetworks returns the networks which are allowed to transfer
+// zones. Addresses without a prefix length are single hosts.
+func (c DnsServeConfig) TransferNetworks() ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, value := range c.AllowTransfer {
+		if !strings.Contains(value, "/") {
+			address := net.ParseIP(value)
+			if address == nil {
+				return nil, fmt.Errorf("invalid address: %s", value)
+			}
+			bits := 8 * net.IPv6len
+			if address.To4() != nil {
+				address = address.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: address, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// GetTsigSecret returns the base64 encoded tsig secret, which is either
+// configured directly or read from TsigSecretFile
+func (c TsigConfig) GetTsigSecret() (string, error) {
+	if c.TsigSecret != "" || c.TsigSecretFile == "" {
+		return c.TsigSecret, nil
+	}
+
+	data, err := ioutil.ReadFile(c.TsigSecretFile)
+	if err != nil {
+		return "", fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// GetAPIKey returns the api key, which is either configured directly or read
+// from APIKeyFile
+func (c DnsPowerDNSConfig) GetAPIKey() (string, error) {
+	if c.APIKey != "" || c.APIKeyFile == "" {
+		return c.APIKey, nil
+	}
+
+	data, err := ioutil.ReadFile(c.APIKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// LoadEnv overrides the configuration with the NETBOX_* environment
+// variables which are set
+func (c *Config) LoadEnv() error {
+	if value := os.Getenv("NETBOX_HOST"); value != "" {
+		c.Netbox.Api = value
+	}
+
+	if value := os.Getenv("NETBOX_TOKEN"); value != "" {
+		c.Netbox.Token = value
+	}
+
+	// Like -tokenfile, a token file overrides the token of the
+	// configuration file, but not NETBOX_TOKEN
+	if value := os.Getenv("NETBOX_TOKEN_FILE"); value != "" {
+		if os.Getenv("NETBOX_TOKEN") == "" {
+			c.Netbox.Token = ""
+		}
+		c.Netbox.TokenFile = value
+	}
+
+	if value := os.Getenv("NETBOX_NOTLS"); value != "" {
+		noTLS, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("NETBOX_NOTLS: %v", err)
+		}
+		c.Netbox.NoTLS = noTLS
+	}
+
+	return nil
+}
+
+// GetToken returns the api token, which is either configured directly or
+// read from TokenFile
+func (c *Config) GetToken() (string, error) {
+	if c.Netbox.Token != "" || c.Netbox.TokenFile == "" {
+		return c.Netbox.Token, nil
+	}
+
+	data, err := ioutil.ReadFile(c.Netbox.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
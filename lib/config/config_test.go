@@ -0,0 +1,318 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/r3boot/as65342-netbox/lib/config"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	fname := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	return fname
+}
+
+func TestLoad(t *testing.T) {
+	fname := writeFile(t, "config.yml", `
+netbox:
+  api: netbox.example.com:443
+  timeout: 30s
+filters:
+  tenants: [customer]
+  platforms:
+    include: ["*"]
+    exclude: [windows*]
+generators:
+  dns:
+    out: /var/named
+`)
+
+	cfg, err := config.Load(fname)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Netbox.Api != "netbox.example.com:443" {
+		t.Errorf("api: got %s", cfg.Netbox.Api)
+	}
+	if cfg.Netbox.Timeout != 30*time.Second {
+		t.Errorf("timeout: got %v", cfg.Netbox.Timeout)
+	}
+	if cfg.Netbox.PageSize != config.Default().Netbox.PageSize {
+		t.Errorf("page_size: expected default, got %d", cfg.Netbox.PageSize)
+	}
+	if !cfg.Filters.Tenants.Match("customer") || cfg.Filters.Tenants.Match("as65342") {
+		t.Errorf("tenants: got %v", cfg.Filters.Tenants)
+	}
+	if !cfg.Filters.Platforms.Match("debian") || cfg.Filters.Platforms.Match("windows-2016") {
+		t.Errorf("platforms: got %v", cfg.Filters.Platforms)
+	}
+	if cfg.Generators.Dns.Out != "/var/named" {
+		t.Errorf("dns out: got %s", cfg.Generators.Dns.Out)
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	fname := writeFile(t, "config.yml", "netbox:\n  hostname: netbox.example.com\n")
+
+	if _, err := config.Load(fname); err == nil {
+		t.Fatalf("Load: expected an error for an unknown key")
+	}
+}
+
+func TestLoadInvalidFilter(t *testing.T) {
+	fname := writeFile(t, "config.yml", "filters:\n  platforms: [\"centos[\"]\n")
+
+	if _, err := config.Load(fname); err == nil {
+		t.Fatalf("Load: expected an error for an invalid pattern")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("NETBOX_HOST", "netbox.example.org:8080")
+	t.Setenv("NETBOX_NOTLS", "true")
+
+	cfg := config.Default()
+	if err := cfg.LoadEnv(); err != nil {
+		t.Fatalf("LoadEnv: %v", err)
+	}
+
+	if cfg.Netbox.Api != "netbox.example.org:8080" {
+		t.Errorf("api: got %s", cfg.Netbox.Api)
+	}
+	if !cfg.Netbox.NoTLS {
+		t.Errorf("notls: expected true")
+	}
+
+	t.Setenv("NETBOX_NOTLS", "maybe")
+	if err := cfg.LoadEnv(); err == nil {
+		t.Errorf("LoadEnv: expected an error for an invalid NETBOX_NOTLS")
+	}
+	t.Setenv("NETBOX_NOTLS", "")
+
+	// NETBOX_TOKEN_FILE overrides the token from the configuration file
+	tokenFile := writeFile(t, "token", "0123456789abcdef\n")
+	t.Setenv("NETBOX_TOKEN_FILE", tokenFile)
+	cfg = config.Default()
+	cfg.Netbox.Token = "fedcba9876543210"
+	if err := cfg.LoadEnv(); err != nil {
+		t.Fatalf("LoadEnv: %v", err)
+	}
+	token, err := cfg.GetToken()
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if token != "0123456789abcdef" {
+		t.Errorf("token: expected the token from NETBOX_TOKEN_FILE, got %q", token)
+	}
+}
+
+func TestGetToken(t *testing.T) {
+	cfg := config.Default()
+	cfg.Netbox.TokenFile = writeFile(t, "token", "0123456789abcdef\n")
+
+	token, err := cfg.GetToken()
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if token != "0123456789abcdef" {
+		t.Errorf("token: got %q", token)
+	}
+
+	cfg.Netbox.Token = "fedcba9876543210"
+	token, _ = cfg.GetToken()
+	if token != "fedcba9876543210" {
+		t.Errorf("token: expected token to take precedence over token_file, got %q", token)
+	}
+}
+
+func TestLoadDnsUpdate(t *testing.T) {
+	secretFile := writeFile(t, "tsig.key", "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0\n")
+	fname := writeFile(t, "config.yml", `
+generators:
+  dns:
+    mode: update
+    update:
+      server: 192.0.2.53:53
+      tsig_name: netbox
+      tsig_secret_file: `+secretFile+`
+`)
+
+	cfg, err := config.Load(fname)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Generators.Dns.Update.Timeout != config.Default().Generators.Dns.Update.Timeout {
+		t.Errorf("timeout: expected default, got %v", cfg.Generators.Dns.Update.Timeout)
+	}
+
+	secret, err := cfg.Generators.Dns.Update.GetTsigSecret()
+	if err != nil {
+		t.Fatalf("GetTsigSecret: %v", err)
+	}
+	if secret != "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0" {
+		t.Errorf("tsig secret: got %q", secret)
+	}
+
+	for _, content := range []string{
+		"generators:\n  dns:\n    mode: update\n",
+		"generators:\n  dns:\n    mode: nsupdate\n",
+	} {
+		if _, err := config.Load(writeFile(t, "config.yml", content)); err == nil {
+			t.Errorf("Load: expected an error for %q", content)
+		}
+	}
+}
+
+func TestLoadDnsPowerDNS(t *testing.T) {
+	keyFile := writeFile(t, "pdns.key", "changeme\n")
+	fname := writeFile(t, "config.yml", `
+generators:
+  dns:
+    mode: powerdns
+    powerdns:
+      url: http://127.0.0.1:8081
+      api_key_file: `+keyFile+`
+`)
+
+	cfg, err := config.Load(fname)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	pdns := cfg.Generators.Dns.PowerDNS
+	if pdns.ServerID != "localhost" || pdns.Kind != "Native" || pdns.Timeout != config.Default().Generators.Dns.PowerDNS.Timeout {
+		t.Errorf("powerdns: expected defaults, got %+v", pdns)
+	}
+
+	key, err := pdns.GetAPIKey()
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if key != "changeme" {
+		t.Errorf("api key: got %q", key)
+	}
+
+	for _, content := range []string{
+		"generators:\n  dns:\n    mode: powerdns\n",
+		"generators:\n  dns:\n    mode: powerdns\n    powerdns:\n      url: http://127.0.0.1:8081\n      kind: Primary\n",
+		"generators:\n  dns:\n    powerdns:\n      api_key: a\n      api_key_file: b\n",
+		"generators:\n  dns:\n    mode: powerdns\n    powerdns:\n      url: http://127.0.0.1:8081\n    views:\n      - name: a\n",
+	} {
+		if _, err := config.Load(writeFile(t, "config.yml", content)); err == nil {
+			t.Errorf("Load: expected an error for %q", content)
+		}
+	}
+}
+
+func TestLoadDnsServe(t *testing.T) {
+	fname := writeFile(t, "config.yml", `
+generators:
+  dns:
+    serve:
+      listen: 127.0.0.1:5353
+      allow_transfer: [192.0.2.53, 2001:db8::/32]
+      notify: [192.0.2.53:53]
+`)
+
+	cfg, err := config.Load(fname)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Generators.Dns.Serve.Refresh != config.Default().Generators.Dns.Serve.Refresh {
+		t.Errorf("refresh: expected default, got %v", cfg.Generators.Dns.Serve.Refresh)
+	}
+
+	networks, err := cfg.Generators.Dns.Serve.TransferNetworks()
+	if err != nil {
+		t.Fatalf("TransferNetworks: %v", err)
+	}
+	if len(networks) != 2 || networks[0].String() != "192.0.2.53/32" || networks[1].String() != "2001:db8::/32" {
+		t.Errorf("allow_transfer: got %v", networks)
+	}
+
+	fname = writeFile(t, "config.yml", "generators:\n  dns:\n    serve:\n      allow_transfer: [secondary]\n")
+	if _, err := config.Load(fname); err == nil {
+		t.Errorf("Load: expected an error for an invalid allow_transfer entry")
+	}
+}
+
+func TestLoadDnssec(t *testing.T) {
+	fname := writeFile(t, "config.yml", `
+generators:
+  dns:
+    dnssec:
+      enabled: true
+      algorithm: ed25519
+      nsec3: true
+      nsec3_salt: aabbccdd
+      zones: ["*.arpa", "!10.in-addr.arpa"]
+`)
+
+	cfg, err := config.Load(fname)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	dnssec := cfg.Generators.Dns.Dnssec
+	if !dnssec.Enabled || dnssec.KeyDir != "keys" || dnssec.Validity != 30*24*time.Hour {
+		t.Errorf("dnssec: expected the defaults to be kept, got %+v", dnssec)
+	}
+	if !dnssec.Zones.Match("2.0.192.in-addr.arpa") || dnssec.Zones.Match("as65342.net") {
+		t.Errorf("zones: got %+v", dnssec.Zones)
+	}
+
+	for _, content := range []string{
+		"generators:\n  dns:\n    dnssec:\n      nsec3_salt: salt\n",
+		"generators:\n  dns:\n    dnssec:\n      validity: 24h\n      refresh: 48h\n",
+	} {
+		if _, err := config.Load(writeFile(t, "config.yml", content)); err == nil {
+			t.Errorf("Load: expected an error for %q", content)
+		}
+	}
+}
+
+func TestLoadViews(t *testing.T) {
+	fname := writeFile(t, "config.yml", `
+generators:
+  dns:
+    views:
+      - name: internal
+        match_clients: [10.0.0.0/8, localnets]
+      - name: external
+        public: true
+        vrfs: [global]
+        roles:
+          exclude: [management]
+`)
+
+	cfg, err := config.Load(fname)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	views := cfg.Generators.Dns.Views
+	if len(views) != 2 || views[0].Name != "internal" || len(views[0].MatchClients) != 2 {
+		t.Fatalf("views: got %+v", views)
+	}
+	if !views[1].Public || !views[1].Vrfs.Match("global") || views[1].Roles.Match("management") {
+		t.Errorf("views: got %+v", views[1])
+	}
+
+	for _, content := range []string{
+		"generators:\n  dns:\n    views:\n      - public: true\n",
+		"generators:\n  dns:\n    views:\n      - name: a\n      - name: a\n",
+		"generators:\n  dns:\n    mode: update\n    update:\n      server: 192.0.2.53:53\n    views:\n      - name: a\n",
+	} {
+		if _, err := config.Load(writeFile(t, "config.yml", content)); err == nil {
+			t.Errorf("Load: expected an error for %q", content)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -48,21 +49,10 @@ type inventoryFileParams struct {
 	Sites     map[string][]common.ManagedDevice
 }
 
-var allowedPlatforms []string = []string{"centos", "openbsd"}
-
-func (g *Generator) AnsibleInventory() (err error) {
-	allEntries, err := g.client.GetHostList()
+func (g *Generator) AnsibleInventory(ctx context.Context) (err error) {
+	entries, err := g.hostList(ctx)
 	if err != nil {
-		return fmt.Errorf("client.GetHostListFor: %v", err)
-	}
-
-	entries := []common.ManagedDevice{}
-	for _, entry := range allEntries {
-		for _, platform := range allowedPlatforms {
-			if platform == entry.Platform {
-				entries = append(entries, entry)
-			}
-		}
+		return fmt.Errorf("hostList: %v", err)
 	}
 
 	tags := make(map[string][]common.ManagedDevice)
@@ -117,8 +107,8 @@ func (g *Generator) AnsibleInventory() (err error) {
 	return nil
 }
 
-func (g *Generator) AnsibleGroupVars() error {
-	entries, err := g.client.ListConfigContexts()
+func (g *Generator) AnsibleGroupVars(ctx context.Context) error {
+	entries, err := g.client.ListConfigContexts(ctx)
 	if err != nil {
 		return fmt.Errorf("client.GetHostListFor: %v", err)
 	}
@@ -153,19 +143,10 @@ func (g *Generator) AnsibleGroupVars() error {
 	return nil
 }
 
-func (g *Generator) AnsibleHostVars() error {
-	allEntries, err := g.client.GetHostList()
+func (g *Generator) AnsibleHostVars(ctx context.Context) error {
+	entries, err := g.hostList(ctx)
 	if err != nil {
-		return fmt.Errorf("client.GetHostListFor: %v", err)
-	}
-
-	entries := []common.ManagedDevice{}
-	for _, entry := range allEntries {
-		for _, platform := range allowedPlatforms {
-			if platform == entry.Platform {
-				entries = append(entries, entry)
-			}
-		}
+		return fmt.Errorf("hostList: %v", err)
 	}
 
 	err = common.CreateDirIfNotExists(g.out + "/host_vars")
@@ -177,10 +158,17 @@ func (g *Generator) AnsibleHostVars() error {
 		fname := entry.Name + ".json"
 		fullFname := g.out + "/host_vars/" + fname
 
-		hostConfig := entry.Config.(map[string]interface{})
+		hostConfig, ok := entry.Config.(map[string]interface{})
+		if !ok {
+			hostConfig = make(map[string]interface{})
+		}
 		hostConfig["primary_ip"] = entry.PrimaryIP
-		hostConfig["primary_ip6"] = entry.PrimaryIP6
-		hostConfig["primary_ip4"] = entry.PrimaryIP4
+		if entry.HasIPv6() {
+			hostConfig["primary_ip6"] = entry.PrimaryIP6
+		}
+		if entry.HasIPv4() {
+			hostConfig["primary_ip4"] = entry.PrimaryIP4
+		}
 		hostConfig["tenant"] = entry.Tenant
 		hostConfig["platform"] = entry.Platform
 		hostConfig["site"] = entry.Site
@@ -1,16 +1,17 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/r3boot/as65342-netbox/lib/common"
 )
 
-func (g Generator) BackupHosts() error {
-	allHosts, err := g.client.GetHostList()
+func (g Generator) BackupHosts(ctx context.Context) error {
+	allHosts, err := g.hostList(ctx)
 	if err != nil {
-		return fmt.Errorf("GetHostList: %v", err)
+		return fmt.Errorf("hostList: %v", err)
 	}
 
 	err = common.CreateDirIfNotExists(g.out)
@@ -1,244 +1,536 @@
 package generator
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"html/template"
+	"net"
 	"os"
-
 	"strings"
+	"text/template"
 
 	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
 )
 
 const (
-	PTR = "PTR"
+	PTR   = "PTR"
+	NS    = "NS"
+	CNAME = "CNAME"
+	SRV   = "SRV"
+	SSHFP = "SSHFP"
+	TLSA  = "TLSA"
+	CAA   = "CAA"
+	TXT   = "TXT"
 )
 
-const reverseDnsZoneTemplate = `$ORIGIN .
-$TTL 60 ; 1 minute
-{{ .Name }}   IN SOA  master.as65342.net. hostmaster.as65342.net. (
+// Prefixes which are larger than these sizes are not turned into reverse
+// zones, since they would be split into too many zones
+const (
+	minReverseIPv4 = 8
+	minReverseIPv6 = 16
+)
+
+// zoneHeaderTemplate contains the SOA, NS and MX records which are at the
+// apex of every zone
+const zoneHeaderTemplate = `$ORIGIN .
+$TTL {{ .Settings.TTL }} ; {{ duration .Settings.TTL }}
+{{ .Name }}   IN SOA  {{ .Settings.SOA.PrimaryNS }} {{ .Settings.SOA.Hostmaster }} (
                                 {{ .Serial }} ; serial
-                                3600       ; refresh (1 hour)
-                                7200       ; retry (2 hours)
-                                2419200    ; expire (4 weeks)
-                                60         ; minimum (1 minute)
+                                {{ timer .Settings.SOA.Refresh }} ; refresh ({{ duration .Settings.SOA.Refresh }})
+                                {{ timer .Settings.SOA.Retry }} ; retry ({{ duration .Settings.SOA.Retry }})
+                                {{ timer .Settings.SOA.Expire }} ; expire ({{ duration .Settings.SOA.Expire }})
+                                {{ timer .Settings.SOA.Minimum }} ; minimum ({{ duration .Settings.SOA.Minimum }})
                                 )
-                        NS      ns.as65342.net.
+{{- range .Settings.NameServers }}
+                        NS      {{ . }}
+{{- end }}
+{{- range .Settings.MailExchangers }}
+                        MX      {{ .Preference }} {{ .Host }}
+{{- end }}
 $ORIGIN {{ .Name }}.
-* PTR unallocated.as65342.net.
+`
+
+const reverseDnsZoneTemplate = zoneHeaderTemplate + `
+{{- if .Settings.Wildcard }}
+* PTR {{ .Settings.Wildcard }}
+{{- end }}
 {{- range .Records }}
-{{ .Name }} {{ .Type }} {{ .Value }}
+{{ .Name }}{{ if .TTL }} {{ .TTL }}{{ end }} {{ .Type }} {{ .Value }}
 {{- end }}
 `
 
-const forwardDnsZoneTemplate = `$ORIGIN .
-$TTL 60 ; 1 minute
-{{ .Name }}   IN SOA  master.as65342.net. hostmaster.as65342.net. (
-                                {{ .Serial }} ; serial
-                                3600       ; refresh (1 hour)
-                                7200       ; retry (2 hours)
-                                2419200    ; expire (4 weeks)
-                                60         ; minimum (1 minute)
-                                )
-                        NS      ns.as65342.net.
-                        MX      10 mail.as65342.net.
-$ORIGIN {{ .Name }}.
+const forwardDnsZoneTemplate = zoneHeaderTemplate + `
 {{- range .Records }}
-{{ .Name }} {{ .Type }} {{ .Value }}
+{{ .Name }}{{ if .TTL }} {{ .TTL }}{{ end }} {{ .Type }} {{ .Value }}
 {{- end }}
 `
 
+// zoneTemplateFuncs are the functions available to the zone templates
+var zoneTemplateFuncs = template.FuncMap{
+	"duration": duration,
+	"timer": func(seconds int) string {
+		return fmt.Sprintf("%-10d", seconds)
+	},
+}
+
+// duration returns a number of seconds in a human readable form, like the
+// comments written by named-compilezone
+func duration(seconds int) string {
+	units := []struct {
+		name    string
+		seconds int
+	}{
+		{"week", 604800},
+		{"day", 86400},
+		{"hour", 3600},
+		{"minute", 60},
+		{"second", 1},
+	}
+
+	parts := []string{}
+	for _, unit := range units {
+		count := seconds / unit.seconds
+		if count == 0 {
+			continue
+		}
+		seconds -= count * unit.seconds
+
+		if count == 1 {
+			parts = append(parts, fmt.Sprintf("%d %s", count, unit.name))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d %ss", count, unit.name))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0 seconds"
+	}
+	return strings.Join(parts, " ")
+}
+
 type Record struct {
 	Name  string `json:"name"`
 	Type  string `json:"type"`
 	Value string `json:"value"`
+	TTL   int    `json:"ttl,omitempty"`
+
+	// object and id refer to the NetBox object the record was made from
+	object string
+	id     int64
 }
 
 type Zone struct {
-	Name    string   `json:"name"`
-	Records []Record `json:"records"`
+	Name     string              `json:"name"`
+	Records  []Record            `json:"records"`
+	Settings common.ZoneSettings `json:"-"`
 }
 
 type ZonesConfig map[string]interface{}
 
 type dnsZoneParams struct {
-	Name    string
-	Serial  string
-	Records []Record
+	Name     string
+	Serial   string
+	Settings common.ZoneSettings
+	Records  []Record
 }
 
-func (g Generator) ReverseDNS(serial string) error {
-	allPrefixes, err := g.client.GetPrefixList("as65342")
+// zoneSettings returns the settings for the zone called name, which are
+// taken from defaults, overridden by the settings configured for the zone
+// in the generator, overridden by the settings in override
+func (g Generator) zoneSettings(defaults common.ZoneSettings, name string, override common.ZoneSettings) (common.ZoneSettings, error) {
+	settings := defaults.Merge(g.Zones[name]).Merge(override).Normalize()
+
+	err := settings.Validate()
 	if err != nil {
-		return fmt.Errorf("GetPrefixList: %v", err)
+		return settings, fmt.Errorf("zone %s: %v", name, err)
 	}
 
-	allIpAddresses, err := g.client.GetIpAddressList("as65342")
+	return settings, nil
+}
+
+// reverseZones returns a reverse zone for every prefix, containing a PTR
+// record for every address in the prefix
+func (g Generator) reverseZones(ctx context.Context) ([]Zone, error) {
+	allPrefixes, err := g.prefixList(ctx)
 	if err != nil {
-		return fmt.Errorf("GetIpAddressList: %v", err)
+		return nil, fmt.Errorf("prefixList: %v", err)
 	}
 
-	allZones := []Zone{}
+	allIpAddresses, err := g.ipAddressList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ipAddressList: %v", err)
+	}
+
+	zoneNetworks := []*net.IPNet{}
+	seen := make(map[string]bool)
 	for _, prefix := range allPrefixes {
-		zone := Zone{
-			Name:    common.ToDnsZoneName(prefix),
-			Records: []Record{},
-		}
-
-		for _, ipAddress := range allIpAddresses {
-			if prefix.Contains(ipAddress.Address) {
-				name := ""
-				if strings.Contains(ipAddress.Address.String(), ":") {
-					i := ipAddress.Address
-					tmp := fmt.Sprintf("%02x%02x%02x%02x%02x%02x%02x%02x", i[8], i[9], i[10], i[11], i[12], i[13], i[14], i[15])
-					for _, v := range tmp {
-						if name == "" {
-							name = string(v)
-						} else {
-							name = string(v) + "." + name
-						}
-					}
-				} else {
-					name = fmt.Sprintf("%v", ipAddress.Address.To4()[3])
-				}
-				r := Record{
-					Name:  name,
-					Type:  PTR,
-					Value: common.ToFqdn(ipAddress.Dns),
-				}
-				zone.Records = append(zone.Records, r)
+		ones, bits := prefix.Network.Mask.Size()
+		if (bits == 32 && ones < minReverseIPv4) || (bits == 128 && ones < minReverseIPv6) {
+			g.client.AddWarnings(common.Warning{
+				Object:  netboxclient.ObjectPrefix,
+				ID:      prefix.ID,
+				Name:    prefix.Network.String(),
+				Message: "prefix is too large for a reverse zone",
+			})
+			continue
+		}
+
+		for _, network := range common.ReverseZoneNetworks(prefix.Network) {
+			if !seen[network.String()] {
+				seen[network.String()] = true
+				zoneNetworks = append(zoneNetworks, network)
 			}
 		}
+	}
 
-		allZones = append(allZones, zone)
+	allZones := []Zone{}
+	for _, network := range zoneNetworks {
+		name := common.ToDnsZoneName(network)
+		settings, err := g.zoneSettings(g.ReverseZone, name, common.ZoneSettings{})
+		if err != nil {
+			return nil, fmt.Errorf("zoneSettings: %v", err)
+		}
+
+		allZones = append(allZones, Zone{
+			Name:     name,
+			Records:  []Record{},
+			Settings: settings,
+		})
 	}
 
-	err = common.CreateDirIfNotExists(g.out)
-	if err != nil {
-		return fmt.Errorf("CreateDirIfNotExists: %v\n", err)
+	// Every address with a dns name gets a PTR record in the most specific
+	// zone containing it, which points to the name holding the address for
+	// aliases
+	aliases := addressAliases(allIpAddresses)
+	seenPtrs := make(map[string]bool)
+	for _, ipAddress := range allIpAddresses {
+		idx := mostSpecificNetwork(zoneNetworks, ipAddress.Address, nil)
+		if idx == -1 {
+			continue
+		}
+
+		if ipAddress.Dns == "" {
+			g.client.AddWarnings(common.Warning{
+				Object:  netboxclient.ObjectIpAddress,
+				ID:      ipAddress.ID,
+				Name:    ipAddress.Address.String(),
+				Message: "has no dns name, it gets no PTR record",
+			})
+			continue
+		}
+
+		target := ipAddress.Dns
+		if alias, ok := aliases[ipAddress.ID]; ok {
+			target = alias
+		}
+
+		name := common.ToPtrName(ipAddress.Address, zoneNetworks[idx])
+		key := strings.ToLower(allZones[idx].Name + " " + name + " " + target)
+		if seenPtrs[key] {
+			continue
+		}
+		seenPtrs[key] = true
+
+		allZones[idx].Records = append(allZones[idx].Records, Record{
+			Name:   name,
+			Type:   PTR,
+			Value:  common.ToFqdn(target),
+			object: netboxclient.ObjectIpAddress,
+			id:     ipAddress.ID,
+		})
 	}
 
-	for _, zone := range allZones {
-		t, err := template.New("reverseDnsZoneTemplate").Parse(reverseDnsZoneTemplate)
-		if err != nil {
-			return fmt.Errorf("template.New: %v", err)
+	// Zones which are contained in another zone are delegated from there.
+	// Classless zones also need a CNAME for every address, see RFC 2317.
+	for idx, network := range zoneNetworks {
+		parent := mostSpecificNetwork(zoneNetworks, network.IP, network)
+		if parent == -1 {
+			continue
 		}
 
-		p := dnsZoneParams{
-			Name:    zone.Name,
-			Serial:  serial,
-			Records: zone.Records,
+		records := []Record{}
+		for _, ns := range allZones[idx].Settings.NameServers {
+			records = append(records, Record{
+				Name:  strings.TrimSuffix(allZones[idx].Name, "."+allZones[parent].Name),
+				Type:  NS,
+				Value: ns,
+			})
 		}
 
-		fname := g.out + "/db." + zone.Name
-		fd, err := os.Create(fname + ".new")
+		if ones, bits := network.Mask.Size(); bits == 32 && ones > 24 {
+			for ip := network.IP; network.Contains(ip); ip = nextAddress(ip) {
+				records = append(records, Record{
+					Name:  common.ToPtrName(ip, zoneNetworks[parent]),
+					Type:  CNAME,
+					Value: common.ToPtrName(ip, network) + "." + common.ToFqdn(allZones[idx].Name),
+				})
+			}
+		}
+
+		allZones[parent].Records = append(allZones[parent].Records, records...)
+	}
+
+	return allZones, nil
+}
+
+// ReverseDNS writes a reverse zone for every prefix, for every view if
+// views are configured. If serial is empty, the serial of every zone is
+// managed automatically, see writeZone.
+func (g Generator) ReverseDNS(ctx context.Context, serial string) error {
+	t, err := template.New("reverseDnsZoneTemplate").Funcs(zoneTemplateFuncs).Parse(reverseDnsZoneTemplate)
+	if err != nil {
+		return fmt.Errorf("template.New: %v", err)
+	}
+
+	for _, vg := range g.viewGenerators() {
+		allZones, err := vg.reverseZones(ctx)
 		if err != nil {
-			return fmt.Errorf("os.Open: %v", err)
+			return fmt.Errorf("reverseZones: %v", err)
 		}
-		defer func() {
-			fd.Close()
-			os.Rename(fname+".new", fname)
-			fmt.Printf("[+] Wrote %s\n", fname)
-		}()
 
-		err = t.Execute(fd, p)
+		err = common.CreateDirIfNotExists(vg.out)
 		if err != nil {
-			return fmt.Errorf("t.Execute: %v", err)
+			return fmt.Errorf("CreateDirIfNotExists: %v\n", err)
+		}
+
+		for _, zone := range allZones {
+			err = vg.writeZone(t, zone, serial)
+			if err != nil {
+				return fmt.Errorf("writeZone %s: %v", zone.Name, err)
+			}
 		}
 	}
 
 	return nil
 }
 
-func (g Generator) ForwardDNS(serial string) error {
-	allConfigContexts, err := g.client.ListConfigContexts()
-	if err != nil {
-		return fmt.Errorf("ListConfigContexts: %v", err)
+// mostSpecificNetwork returns the index of the longest network containing ip,
+// ignoring exclude, and -1 if none of the networks contain ip
+func mostSpecificNetwork(networks []*net.IPNet, ip net.IP, exclude *net.IPNet) int {
+	best := -1
+	bestOnes := -1
+	for idx, network := range networks {
+		if network == exclude || !network.Contains(ip) {
+			continue
+		}
+
+		ones, _ := network.Mask.Size()
+		if exclude != nil {
+			if excludeOnes, _ := exclude.Mask.Size(); ones >= excludeOnes {
+				continue
+			}
+		}
+
+		if ones > bestOnes {
+			best = idx
+			bestOnes = ones
+		}
 	}
 
-	allIpAddresses, err := g.client.GetIpAddressList("as65342")
-	if err != nil {
-		return fmt.Errorf("GetIpAddressList: %v", err)
-	}
-
-	allZonesNoHosts := []Zone{}
-	for _, context := range allConfigContexts {
-		if context.Name == "dns_zones" {
-			zones := context.Config.(map[string]interface{})["dns_zones"].([]interface{})
-			for _, zoneData := range zones {
-				zone := zoneData.(map[string]interface{})
-				newZone := Zone{
-					Name:    zone["name"].(string),
-					Records: []Record{},
+	return best
+}
+
+// nextAddress returns the address which follows ip
+func nextAddress(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for idx := len(next) - 1; idx >= 0; idx-- {
+		next[idx]++
+		if next[idx] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// toInt converts a number found in a config context to an int. The api
+// client decodes numbers as json.Number, while snapshots contain float64s.
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return int(i), err == nil
+	case float64:
+		return int(v), v == float64(int(v))
+	}
+	return 0, false
+}
+
+// parseDnsZones returns the zones defined in the dns_zones config context
+func parseDnsZones(contexts []common.ConfigContext) ([]Zone, error) {
+	allZones := []Zone{}
+	for _, context := range contexts {
+		if context.Name != "dns_zones" {
+			continue
+		}
+
+		config, ok := context.Config.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config context %s: data is not an object", context.Name)
+		}
+
+		zones, ok := config["dns_zones"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config context %s: dns_zones is not a list", context.Name)
+		}
+
+		for idx, zoneData := range zones {
+			zone, ok := zoneData.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("config context %s: zone %d is not an object", context.Name, idx)
+			}
+
+			name, ok := zone["name"].(string)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("config context %s: zone %d has no name", context.Name, idx)
+			}
+
+			newZone := Zone{
+				Name:    name,
+				Records: []Record{},
+			}
+
+			// The ttl, soa, ns and mx keys of a zone override the defaults
+			data, err := json.Marshal(zone)
+			if err != nil {
+				return nil, fmt.Errorf("config context %s: zone %s: json.Marshal: %v", context.Name, name, err)
+			}
+			err = json.Unmarshal(data, &newZone.Settings)
+			if err != nil {
+				return nil, fmt.Errorf("config context %s: zone %s: invalid settings: %v", context.Name, name, err)
+			}
+
+			records, ok := zone["records"].([]interface{})
+			if !ok && zone["records"] != nil {
+				return nil, fmt.Errorf("config context %s: records of zone %s is not a list", context.Name, name)
+			}
+
+			for ridx, recordData := range records {
+				record, ok := recordData.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("config context %s: record %d of zone %s is not an object", context.Name, ridx, name)
+				}
+
+				r := Record{
+					object: netboxclient.ObjectConfigContext,
+					id:     context.ID,
 				}
-				records := zone["records"].([]interface{})
-				for _, recordData := range records {
-					record := recordData.(map[string]interface{})
-					r := Record{
-						Name:  record["name"].(string),
-						Type:  record["type"].(string),
-						Value: record["value"].(string),
+				r.Name, ok = record["name"].(string)
+				if !ok {
+					return nil, fmt.Errorf("config context %s: record %d of zone %s has no name", context.Name, ridx, name)
+				}
+				r.Type, ok = record["type"].(string)
+				if !ok {
+					return nil, fmt.Errorf("config context %s: record %d of zone %s has no type", context.Name, ridx, name)
+				}
+				r.Value, ok = record["value"].(string)
+				if !ok {
+					return nil, fmt.Errorf("config context %s: record %d of zone %s has no value", context.Name, ridx, name)
+				}
+				if ttl, found := record["ttl"]; found {
+					r.TTL, ok = toInt(ttl)
+					if !ok || r.TTL < 0 {
+						return nil, fmt.Errorf("config context %s: record %d of zone %s has an invalid ttl", context.Name, ridx, name)
 					}
-					newZone.Records = append(newZone.Records, r)
 				}
-				allZonesNoHosts = append(allZonesNoHosts, newZone)
+				newZone.Records = append(newZone.Records, r)
 			}
+
+			allZones = append(allZones, newZone)
 		}
 	}
 
+	return allZones, nil
+}
+
+// forwardZones returns the zones defined in the dns_zones config context,
+// extended with the records derived from NetBox, see derivedRecords
+func (g Generator) forwardZones(ctx context.Context) ([]Zone, error) {
+	allConfigContexts, err := g.client.ListConfigContexts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListConfigContexts: %v", err)
+	}
+
+	allIpAddresses, err := g.ipAddressList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ipAddressList: %v", err)
+	}
+
+	allServices, err := g.client.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListServices: %v", err)
+	}
+
+	allHosts, err := g.hostList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("hostList: %v", err)
+	}
+
+	allZonesNoHosts, err := parseDnsZones(allConfigContexts)
+	if err != nil {
+		return nil, fmt.Errorf("parseDnsZones: %v", err)
+	}
+
+	records, warnings := derivedRecords(allIpAddresses, allServices, allHosts, g.BaseURL)
+	g.client.AddWarnings(warnings...)
+
 	allZones := []Zone{}
 	for _, zone := range allZonesNoHosts {
-		for _, ip := range allIpAddresses {
-			if strings.HasSuffix(ip.Dns, zone.Name) {
-				hostName := strings.Replace(ip.Dns, "."+zone.Name, "", -1)
-				r := Record{
-					Name:  hostName,
-					Value: ip.Address.String(),
-				}
+		zone.Settings, err = g.zoneSettings(g.ForwardZone, zone.Name, zone.Settings)
+		if err != nil {
+			return nil, fmt.Errorf("zoneSettings: %v", err)
+		}
 
-				if strings.Contains(r.Value, ":") {
-					r.Type = "AAAA"
-				} else {
-					r.Type = "A"
-				}
+		// Public views never publish private addresses, not even the
+		// ones which are configured explicitly
+		static := []Record{}
+		for _, r := range zone.Records {
+			if !g.view.allowsRecord(r) {
+				fmt.Fprintf(os.Stderr, "WARNING: view %s: %s: not publishing private address %s of %s\n", g.view.Name, zone.Name, r.Value, r.Name)
+				continue
+			}
+			static = append(static, r)
+		}
+		zone.Records = append(static, caaRecords(zone.Settings)...)
 
+		for _, r := range records {
+			if name, ok := relativeName(r.Name, zone.Name); ok {
+				r.Name = name
 				zone.Records = append(zone.Records, r)
 			}
 		}
 		allZones = append(allZones, zone)
 	}
 
-	err = common.CreateDirIfNotExists(g.out)
+	return allZones, nil
+}
+
+// ForwardDNS writes the zones returned by forwardZones, for every view if
+// views are configured. If serial is empty, the serial of every zone is
+// managed automatically, see writeZone.
+func (g Generator) ForwardDNS(ctx context.Context, serial string) error {
+	t, err := template.New("forwardDnsZoneTemplate").Funcs(zoneTemplateFuncs).Parse(forwardDnsZoneTemplate)
 	if err != nil {
-		return fmt.Errorf("CreateDirIfNotExists: %v\n", err)
+		return fmt.Errorf("template.New: %v", err)
 	}
 
-	for _, zone := range allZones {
-		t, err := template.New("forwardDnsZoneTemplate").Parse(forwardDnsZoneTemplate)
+	for _, vg := range g.viewGenerators() {
+		allZones, err := vg.forwardZones(ctx)
 		if err != nil {
-			return fmt.Errorf("template.New: %v", err)
+			return fmt.Errorf("forwardZones: %v", err)
 		}
 
-		p := dnsZoneParams{
-			Name:    zone.Name,
-			Serial:  serial,
-			Records: zone.Records,
-		}
-
-		fname := g.out + "/db." + zone.Name
-		fd, err := os.Create(fname + ".new")
+		err = common.CreateDirIfNotExists(vg.out)
 		if err != nil {
-			return fmt.Errorf("os.Open: %v", err)
+			return fmt.Errorf("CreateDirIfNotExists: %v\n", err)
 		}
-		defer func() {
-			fd.Close()
-			os.Rename(fname+".new", fname)
-			fmt.Printf("[+] Wrote %s\n", fname)
-		}()
 
-		err = t.Execute(fd, p)
-		if err != nil {
-			return fmt.Errorf("t.Execute: %v", err)
+		for _, zone := range allZones {
+			err = vg.writeZone(t, zone, serial)
+			if err != nil {
+				return fmt.Errorf("writeZone %s: %v", zone.Name, err)
+			}
 		}
 	}
 
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+func TestZoneSettings(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	out := g.out
+
+	g.Zones = map[string]common.ZoneSettings{
+		"64-26.2.0.192.in-addr.arpa": {
+			TTL:         86400,
+			NameServers: []string{"ns1.example.org", "ns2.example.org"},
+			Wildcard:    "unallocated.example.org",
+		},
+	}
+	g.ReverseZone.Wildcard = ""
+
+	err := g.ReverseDNS(context.Background(), testSerial)
+	if err != nil {
+		t.Fatalf("ReverseDNS: %v", err)
+	}
+
+	expected := map[string][]string{
+		"db.64-26.2.0.192.in-addr.arpa": {
+			"$TTL 86400 ; 1 day\n",
+			"NS      ns1.example.org.\n",
+			"NS      ns2.example.org.\n",
+			"expire (4 weeks)",
+			"$ORIGIN 64-26.2.0.192.in-addr.arpa.\n* PTR unallocated.example.org.\n",
+		},
+		"db.2.0.192.in-addr.arpa": {
+			"$TTL 60 ; 1 minute\n",
+			"64-26 NS ns1.example.org.\n",
+			"64-26 NS ns2.example.org.\n",
+		},
+	}
+	for fname, lines := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(out, fname))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+
+		for _, line := range lines {
+			if !strings.Contains(string(data), line) {
+				t.Errorf("%s: expected %q in:\n%s", fname, line, data)
+			}
+		}
+	}
+
+	// Without a wildcard target, reverse zones have no wildcard
+	data, err := ioutil.ReadFile(filepath.Join(out, "db.2.0.192.in-addr.arpa"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	if strings.Contains(string(data), "* PTR") {
+		t.Errorf("db.2.0.192.in-addr.arpa: unexpected wildcard in:\n%s", data)
+	}
+
+	g.ReverseZone.Wildcard = "unallocated example.org"
+	if err := g.ReverseDNS(context.Background(), testSerial); err == nil {
+		t.Errorf("ReverseDNS: expected an error for an invalid wildcard")
+	}
+	g.ReverseZone.Wildcard = ""
+
+	g.ReverseZone.NameServers = []string{}
+	g.Zones = nil
+	if err := g.ReverseDNS(context.Background(), testSerial); err == nil {
+		t.Errorf("ReverseDNS: expected an error for zones without name servers")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := map[int]string{
+		0:       "0 seconds",
+		60:      "1 minute",
+		5400:    "1 hour 30 minutes",
+		2419200: "4 weeks",
+	}
+
+	for seconds, expected := range tests {
+		if result := duration(seconds); result != expected {
+			t.Errorf("duration(%d): expected %s, got %s", seconds, expected, result)
+		}
+	}
+}
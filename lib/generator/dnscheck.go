@@ -0,0 +1,273 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+// maxAliases is the maximum number of CNAMEs followed during a lookup
+const maxAliases = 8
+
+// zoneIndex contains the records of a set of zones indexed by their fully
+// qualified owner name. names contains every name which exists in the
+// zones, including empty non-terminals.
+type zoneIndex struct {
+	zones   []string
+	records map[string][]Record
+	names   map[string]bool
+}
+
+// qualify returns name as a fully qualified, lowercase name, using origin
+// for relative names
+func qualify(name, origin string) string {
+	name = strings.ToLower(name)
+	origin = dns.Fqdn(strings.ToLower(origin))
+
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	}
+	return name + "." + origin
+}
+
+func newZoneIndex(zones []Zone) zoneIndex {
+	index := zoneIndex{
+		records: make(map[string][]Record),
+		names:   make(map[string]bool),
+	}
+
+	for _, zone := range zones {
+		apex := dns.Fqdn(strings.ToLower(zone.Name))
+		index.zones = append(index.zones, apex)
+		index.names[apex] = true
+		for _, r := range zone.Records {
+			owner := qualify(r.Name, zone.Name)
+			if r.Type == CNAME || r.Type == PTR {
+				r.Value = qualify(r.Value, zone.Name)
+			}
+			index.records[owner] = append(index.records[owner], r)
+
+			labels := dns.SplitDomainName(owner)
+			for idx := range labels {
+				name := dns.Fqdn(strings.Join(labels[idx:], "."))
+				if !dns.IsSubDomain(apex, name) {
+					break
+				}
+				index.names[name] = true
+			}
+		}
+	}
+
+	return index
+}
+
+// owner returns the records of name, or the records of the wildcard
+// matching name if name does not exist, see RFC 4592
+func (z zoneIndex) owner(name string) []Record {
+	if z.names[name] {
+		return z.records[name]
+	}
+
+	labels := dns.SplitDomainName(name)
+	for idx := 1; idx < len(labels); idx++ {
+		encloser := dns.Fqdn(strings.Join(labels[idx:], "."))
+		if !z.contains(encloser) {
+			return nil
+		}
+		if z.names[encloser] {
+			return z.records["*."+encloser]
+		}
+	}
+
+	return nil
+}
+
+// contains returns true if name is part of any of the zones
+func (z zoneIndex) contains(name string) bool {
+	for _, zone := range z.zones {
+		if dns.IsSubDomain(zone, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the values of the records of type rrtype for name,
+// following CNAMEs and wildcards within the zones
+func (z zoneIndex) lookup(name, rrtype string) []string {
+	name = dns.Fqdn(strings.ToLower(name))
+
+	for i := 0; i < maxAliases; i++ {
+		values := []string{}
+		alias := ""
+		for _, r := range z.owner(name) {
+			switch r.Type {
+			case rrtype:
+				values = append(values, r.Value)
+			case CNAME:
+				alias = r.Value
+			}
+		}
+
+		if alias == "" || len(values) > 0 {
+			return values
+		}
+		name = alias
+	}
+
+	return nil
+}
+
+// resolvesTo returns true if name has an A or AAAA record for address
+func (z zoneIndex) resolvesTo(name string, address net.IP) bool {
+	for _, rrtype := range []string{"A", "AAAA"} {
+		for _, value := range z.lookup(name, rrtype) {
+			if address.Equal(net.ParseIP(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkConsistency cross-checks the forward zones against the reverse zones
+// and returns a warning for every address which does not have forward
+// confirmed reverse dns
+func checkConsistency(forwardZones, reverseZones []Zone, allIpAddresses []common.IpAddress) []common.Warning {
+	// The wildcard PTR record of reverse zones is added by their template
+	withWildcards := []Zone{}
+	for _, zone := range reverseZones {
+		if zone.Settings.Wildcard != "" {
+			zone.Records = append([]Record{{Name: "*", Type: PTR, Value: zone.Settings.Wildcard}}, zone.Records...)
+		}
+		withWildcards = append(withWildcards, zone)
+	}
+
+	forward := newZoneIndex(forwardZones)
+	reverse := newZoneIndex(withWildcards)
+
+	warnings := []common.Warning{}
+	seen := make(map[string]bool)
+	warn := func(object string, id int64, name, format string, args ...interface{}) {
+		w := common.Warning{
+			Object:  object,
+			ID:      id,
+			Name:    strings.TrimSuffix(name, "."),
+			Message: fmt.Sprintf(format, args...),
+		}
+		if !seen[w.String()] {
+			seen[w.String()] = true
+			warnings = append(warnings, w)
+		}
+	}
+
+	// Every A and AAAA record needs a PTR record pointing back to it
+	for _, zone := range forwardZones {
+		for _, r := range zone.Records {
+			if r.Type != "A" && r.Type != "AAAA" {
+				continue
+			}
+
+			address := net.ParseIP(r.Value)
+			if address == nil {
+				continue
+			}
+
+			owner := qualify(r.Name, zone.Name)
+			reverseName, _ := dns.ReverseAddr(address.String())
+			if !reverse.contains(reverseName) {
+				warn(r.object, r.id, owner, "%s record %s is not in any reverse zone", r.Type, r.Value)
+				continue
+			}
+
+			targets := reverse.lookup(reverseName, PTR)
+			if len(targets) == 0 {
+				warn(r.object, r.id, owner, "%s record %s has no PTR record", r.Type, r.Value)
+				continue
+			}
+
+			found := false
+			for _, target := range targets {
+				if target == owner {
+					found = true
+				}
+			}
+			if !found {
+				warn(r.object, r.id, owner, "%s record %s has a PTR record pointing to %s", r.Type, r.Value, strings.Join(targets, ", "))
+			}
+		}
+	}
+
+	// Every PTR record needs to point to a name which resolves back to the
+	// same address
+	for _, ip := range allIpAddresses {
+		if ip.Dns == "" {
+			continue
+		}
+
+		name := dns.Fqdn(strings.ToLower(ip.Dns))
+		reverseName, _ := dns.ReverseAddr(ip.Address.String())
+
+		if !reverse.contains(reverseName) {
+			if !forward.contains(name) {
+				warn(netboxclient.ObjectIpAddress, ip.ID, ip.Address.String(), "dns name %s does not match any forward zone, and the address is not in any reverse zone", ip.Dns)
+			}
+			continue
+		}
+
+		for _, target := range reverse.lookup(reverseName, PTR) {
+			switch {
+			case !forward.contains(target):
+				warn(netboxclient.ObjectIpAddress, ip.ID, ip.Address.String(), "PTR record points to %s, which is not in any forward zone", target)
+			case !forward.resolvesTo(target, ip.Address):
+				warn(netboxclient.ObjectIpAddress, ip.ID, ip.Address.String(), "PTR record points to %s, which does not resolve to it", target)
+			}
+		}
+	}
+
+	return warnings
+}
+
+// CheckDNS cross-checks the forward and reverse zones which would be
+// generated, and returns every record which breaks forward confirmed
+// reverse dns. With views, every view is checked against its own addresses,
+// and the warnings are prefixed with the name of the view.
+func (g *Generator) CheckDNS(ctx context.Context) ([]common.Warning, error) {
+	warnings := []common.Warning{}
+	for _, vg := range g.viewGenerators() {
+		forwardZones, err := vg.forwardZones(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("forwardZones: %v", err)
+		}
+
+		reverseZones, err := vg.reverseZones(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reverseZones: %v", err)
+		}
+
+		allIpAddresses, err := vg.ipAddressList(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ipAddressList: %v", err)
+		}
+
+		viewWarnings := checkConsistency(forwardZones, reverseZones, allIpAddresses)
+		for idx := range viewWarnings {
+			if vg.view != nil {
+				viewWarnings[idx].Message = "view " + vg.view.Name + ": " + viewWarnings[idx].Message
+			}
+		}
+		warnings = append(warnings, viewWarnings...)
+	}
+	sortWarnings(warnings)
+
+	return warnings, nil
+}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+// compareWarnings checks that warnings contains exactly the expected
+// warnings, in order
+func compareWarnings(t *testing.T, warnings []common.Warning, expected []string) {
+	t.Helper()
+
+	if len(warnings) != len(expected) {
+		for _, w := range warnings {
+			t.Logf("got: %s", w)
+		}
+		t.Fatalf("expected %d warnings, got %d", len(expected), len(warnings))
+	}
+
+	for idx, w := range warnings {
+		if w.String() != expected[idx] {
+			t.Errorf("warning %d: expected %q, got %q", idx, expected[idx], w.String())
+		}
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	g, _ := newTestGenerator(t)
+
+	warnings, err := g.CheckDNS(context.Background())
+	if err != nil {
+		t.Fatalf("CheckDNS: %v", err)
+	}
+
+	// lb01 resolves through the RFC 2317 CNAMEs, so it is not reported.
+	// The static records are answered by the wildcard of the reverse zone.
+	compareWarnings(t, warnings, []string{
+		"extras.config-context 1 (ns.as65342.net) A record 192.0.2.53 has a PTR record pointing to unallocated.as65342.net.",
+		"extras.config-context 1 (mail.as65342.net) A record 192.0.2.25 has a PTR record pointing to unallocated.as65342.net.",
+		"extras.config-context 1 (ns1.example.org) A record 192.0.2.53 has a PTR record pointing to unallocated.as65342.net.",
+		"extras.config-context 1 (mx1.example.org) A record 192.0.2.25 has a PTR record pointing to unallocated.as65342.net.",
+		"ipam.ip-address 13 (198.51.100.5) dns name www.example.com does not match any forward zone, and the address is not in any reverse zone",
+		"ipam.ip-address 14 (2001:db8:ffff::5) dns name www.example.com does not match any forward zone, and the address is not in any reverse zone",
+	})
+
+	// Without the wildcard, the static records have no PTR record at all
+	g, _ = newTestGenerator(t)
+	g.ReverseZone.Wildcard = ""
+
+	warnings, err = g.CheckDNS(context.Background())
+	if err != nil {
+		t.Fatalf("CheckDNS: %v", err)
+	}
+
+	compareWarnings(t, warnings, []string{
+		"extras.config-context 1 (ns.as65342.net) A record 192.0.2.53 has no PTR record",
+		"extras.config-context 1 (mail.as65342.net) A record 192.0.2.25 has no PTR record",
+		"extras.config-context 1 (ns1.example.org) A record 192.0.2.53 has no PTR record",
+		"extras.config-context 1 (mx1.example.org) A record 192.0.2.25 has no PTR record",
+		"ipam.ip-address 13 (198.51.100.5) dns name www.example.com does not match any forward zone, and the address is not in any reverse zone",
+		"ipam.ip-address 14 (2001:db8:ffff::5) dns name www.example.com does not match any forward zone, and the address is not in any reverse zone",
+	})
+}
+
+func TestCheckDNSViews(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	g.Views = []View{
+		{Name: "management", Vrfs: common.Filter{Include: []string{"internal"}}},
+	}
+
+	warnings, err := g.CheckDNS(context.Background())
+	if err != nil {
+		t.Fatalf("CheckDNS: %v", err)
+	}
+
+	// Only the static records are outside of the reverse zones of the
+	// view, the addresses which are not part of the view are not reported
+	compareWarnings(t, warnings, []string{
+		"extras.config-context 1 (ns.as65342.net) view management: A record 192.0.2.53 is not in any reverse zone",
+		"extras.config-context 1 (mail.as65342.net) view management: A record 192.0.2.25 is not in any reverse zone",
+		"extras.config-context 1 (ns1.example.org) view management: A record 192.0.2.53 is not in any reverse zone",
+		"extras.config-context 1 (mx1.example.org) view management: A record 192.0.2.25 is not in any reverse zone",
+	})
+}
+
+func TestCheckConsistency(t *testing.T) {
+	forward := []Zone{{
+		Name: "example.org",
+		Records: []Record{
+			{Name: "www", Type: "A", Value: "192.0.2.80", object: "test", id: 1},
+			{Name: "web", Type: "CNAME", Value: "www", object: "test", id: 2},
+			{Name: "mail", Type: "A", Value: "192.0.2.25", object: "test", id: 3},
+			{Name: "db", Type: "A", Value: "10.0.0.1", object: "test", id: 4},
+		},
+	}}
+
+	reverse := []Zone{{
+		Name: "2.0.192.in-addr.arpa",
+		Records: []Record{
+			{Name: "80", Type: PTR, Value: "web.example.org."},
+			{Name: "25", Type: PTR, Value: "smtp.example.org."},
+			{Name: "26", Type: PTR, Value: "mail.example.net."},
+		},
+	}}
+
+	addresses := []common.IpAddress{
+		{ID: 1, Address: net.ParseIP("192.0.2.80"), Dns: "web.example.org"},
+		{ID: 2, Address: net.ParseIP("192.0.2.25"), Dns: "smtp.example.org"},
+		{ID: 3, Address: net.ParseIP("192.0.2.26"), Dns: "mail.example.net"},
+	}
+
+	compareWarnings(t, checkConsistency(forward, reverse, addresses), []string{
+		"test 1 (www.example.org) A record 192.0.2.80 has a PTR record pointing to web.example.org.",
+		"test 3 (mail.example.org) A record 192.0.2.25 has a PTR record pointing to smtp.example.org.",
+		"test 4 (db.example.org) A record 10.0.0.1 is not in any reverse zone",
+		"ipam.ip-address 2 (192.0.2.25) PTR record points to smtp.example.org., which does not resolve to it",
+		"ipam.ip-address 3 (192.0.2.26) PTR record points to mail.example.net., which is not in any forward zone",
+	})
+}
@@ -0,0 +1,556 @@
+package generator
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+// signatureSkew is subtracted from the inception of signatures, so they
+// are valid on resolvers with a clock which runs behind
+const signatureSkew = time.Hour
+
+// Dnssec contains the settings used to sign zones
+type Dnssec struct {
+	// KeyDir contains the keys of every zone in the same format as used by
+	// BIND, missing keys are generated
+	KeyDir    string
+	Algorithm uint8
+
+	// NSEC3 selects NSEC3 instead of NSEC chains, using Iterations and the
+	// hex encoded Salt
+	NSEC3      bool
+	Iterations uint16
+	Salt       string
+
+	// Validity is the lifetime of signatures, and zones are signed again
+	// once their signatures expire within Refresh
+	Validity time.Duration
+	Refresh  time.Duration
+
+	// Zones selects the zones which are signed
+	Zones common.Filter
+}
+
+// ParseDnssecAlgorithm returns the DNSSEC algorithm called name
+func ParseDnssecAlgorithm(name string) (uint8, error) {
+	switch strings.ToLower(name) {
+	case "", "ecdsap256sha256":
+		return dns.ECDSAP256SHA256, nil
+	case "ed25519":
+		return dns.ED25519, nil
+	}
+
+	return 0, fmt.Errorf("unsupported algorithm: %s", name)
+}
+
+// signs returns true if zone needs to be signed
+func (d *Dnssec) signs(zone string) bool {
+	return d != nil && d.Zones.Match(strings.TrimSuffix(zone, "."))
+}
+
+// signingKey is a DNSKEY together with its private key
+type signingKey struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// isKSK returns true if k is a key signing key
+func (k signingKey) isKSK() bool {
+	return k.key.Flags&dns.SEP != 0
+}
+
+// keyFileBase returns the path of the key files of key, without extension
+func (d *Dnssec) keyFileBase(key *dns.DNSKEY) string {
+	return filepath.Join(d.KeyDir, fmt.Sprintf("K%s+%03d+%05d", key.Hdr.Name, key.Algorithm, key.KeyTag()))
+}
+
+// readKey reads the key stored in the .key and .private files below base
+func readKey(base string) (signingKey, error) {
+	data, err := ioutil.ReadFile(base + ".key")
+	if err != nil {
+		return signingKey{}, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	var key *dns.DNSKEY
+	zp := dns.NewZoneParser(bytes.NewReader(data), "", base+".key")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if v, ok := rr.(*dns.DNSKEY); ok {
+			key = v
+			break
+		}
+	}
+	if zp.Err() != nil {
+		return signingKey{}, fmt.Errorf("%s.key: %v", base, zp.Err())
+	}
+	if key == nil {
+		return signingKey{}, fmt.Errorf("%s.key: no DNSKEY record found", base)
+	}
+
+	fd, err := os.Open(base + ".private")
+	if err != nil {
+		return signingKey{}, fmt.Errorf("os.Open: %v", err)
+	}
+	defer fd.Close()
+
+	private, err := key.ReadPrivateKey(fd, base+".private")
+	if err != nil {
+		return signingKey{}, fmt.Errorf("ReadPrivateKey: %v", err)
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return signingKey{}, fmt.Errorf("%s.private: unsupported private key", base)
+	}
+
+	return signingKey{key: key, signer: signer}, nil
+}
+
+// generateKey creates a new key for zone and stores it below KeyDir
+func (d *Dnssec) generateKey(zone string, flags uint16) (signingKey, error) {
+	key := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: d.Algorithm,
+	}
+
+	private, err := key.Generate(256)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("Generate: %v", err)
+	}
+
+	kind := "zone-signing"
+	if flags&dns.SEP != 0 {
+		kind = "key-signing"
+	}
+
+	base := d.keyFileBase(key)
+	public := fmt.Sprintf("; This is a %s key, keyid %d, for %s\n%s\n", kind, key.KeyTag(), zone, key)
+	err = ioutil.WriteFile(base+".key", []byte(public), 0644)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+
+	err = ioutil.WriteFile(base+".private", []byte(key.PrivateKeyString(private)), 0600)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+	fmt.Printf("[+] Generated %s key %s\n", kind, base)
+
+	return signingKey{key: key, signer: private.(crypto.Signer)}, nil
+}
+
+// zoneKeys returns all keys of zone which use the configured algorithm. A
+// key signing key and a zone signing key are generated if the zone does not
+// have them yet. Multiple keys of the same kind are all used, which allows
+// keys to be rolled over by adding the new key before removing the old one.
+func (d *Dnssec) zoneKeys(zone string) ([]signingKey, error) {
+	zone = dns.Fqdn(strings.ToLower(zone))
+
+	err := os.MkdirAll(d.KeyDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %v", err)
+	}
+
+	fnames, err := filepath.Glob(filepath.Join(d.KeyDir, fmt.Sprintf("K%s+%03d+*.key", zone, d.Algorithm)))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob: %v", err)
+	}
+	sort.Strings(fnames)
+
+	keys := []signingKey{}
+	haveKSK, haveZSK := false, false
+	for _, fname := range fnames {
+		key, err := readKey(strings.TrimSuffix(fname, ".key"))
+		if err != nil {
+			return nil, fmt.Errorf("readKey: %v", err)
+		}
+
+		if key.isKSK() {
+			haveKSK = true
+		} else {
+			haveZSK = true
+		}
+		keys = append(keys, key)
+	}
+
+	if !haveKSK {
+		key, err := d.generateKey(zone, dns.ZONE|dns.SEP)
+		if err != nil {
+			return nil, fmt.Errorf("generateKey: %v", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if !haveZSK {
+		key, err := d.generateKey(zone, dns.ZONE)
+		if err != nil {
+			return nil, fmt.Errorf("generateKey: %v", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// canonicalLess orders names as described in RFC 4034, section 6.1
+func canonicalLess(a, b string) bool {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		x, y := la[len(la)-i], lb[len(lb)-i]
+		if x != y {
+			return x < y
+		}
+	}
+
+	return len(la) < len(lb)
+}
+
+// typeBitMap returns the sorted and deduplicated types of rrs, together
+// with extra
+func typeBitMap(rrs []dns.RR, extra ...uint16) []uint16 {
+	seen := make(map[uint16]bool)
+	types := []uint16{}
+	for _, rr := range rrs {
+		extra = append(extra, rr.Header().Rrtype)
+	}
+	for _, t := range extra {
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	return types
+}
+
+// signZone returns the records of the zone origin in rrs, extended with the
+// DNSKEY records of keys, an NSEC or NSEC3 chain and the signatures of all
+// authoritative data
+func (d *Dnssec) signZone(origin string, rrs []dns.RR, keys []signingKey, now time.Time) ([]dns.RR, error) {
+	origin = dns.Fqdn(strings.ToLower(origin))
+
+	var soa *dns.SOA
+	owners := make(map[string][]dns.RR)
+	add := func(rr dns.RR) {
+		owner := rr.Header().Name
+		owners[owner] = append(owners[owner], rr)
+	}
+
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		rr.Header().Name = strings.ToLower(rr.Header().Name)
+		if v, ok := rr.(*dns.SOA); ok && rr.Header().Name == origin {
+			soa = v
+		}
+		add(rr)
+	}
+	if soa == nil {
+		return nil, fmt.Errorf("%s: no SOA record", origin)
+	}
+
+	negativeTtl := soa.Minttl
+	if soa.Hdr.Ttl < negativeTtl {
+		negativeTtl = soa.Hdr.Ttl
+	}
+
+	for _, k := range keys {
+		key := dns.Copy(k.key).(*dns.DNSKEY)
+		key.Hdr.Name = origin
+		key.Hdr.Ttl = soa.Hdr.Ttl
+		add(key)
+	}
+
+	if d.NSEC3 {
+		add(&dns.NSEC3PARAM{
+			Hdr:        dns.RR_Header{Name: origin, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET},
+			Hash:       dns.SHA1,
+			Iterations: d.Iterations,
+			SaltLength: uint8(len(d.Salt) / 2),
+			Salt:       d.Salt,
+		})
+	}
+
+	// Names with NS records below the apex are zone cuts, data below them
+	// is glue which is neither signed nor part of the chain
+	names := []string{}
+	cuts := []string{}
+	for name, rrs := range owners {
+		names = append(names, name)
+		if name == origin {
+			continue
+		}
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeNS {
+				cuts = append(cuts, name)
+				break
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+
+	isCut := func(name string) bool {
+		for _, cut := range cuts {
+			if name == cut {
+				return true
+			}
+		}
+		return false
+	}
+	occluded := func(name string) bool {
+		for _, cut := range cuts {
+			if name != cut && dns.IsSubDomain(cut, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	authoritative := []string{}
+	for _, name := range names {
+		if !occluded(name) {
+			authoritative = append(authoritative, name)
+		}
+	}
+
+	// signed returns the records at name which are signed, the NS records
+	// and glue at a zone cut belong to the child zone
+	signed := func(name string) []dns.RR {
+		result := []dns.RR{}
+		for _, rr := range owners[name] {
+			t := rr.Header().Rrtype
+			if isCut(name) && t != dns.TypeDS && t != dns.TypeNSEC {
+				continue
+			}
+			result = append(result, rr)
+		}
+		return result
+	}
+
+	if d.NSEC3 {
+		// The chain also covers the empty non-terminals between the
+		// names and the apex
+		chainNames := make(map[string]bool)
+		for _, name := range authoritative {
+			for n := name; n != origin && dns.IsSubDomain(origin, n); {
+				chainNames[n] = true
+				labels := dns.SplitDomainName(n)
+				n = dns.Fqdn(strings.Join(labels[1:], "."))
+			}
+			chainNames[origin] = true
+		}
+
+		hashes := make(map[string]string)
+		hashed := []string{}
+		for name := range chainNames {
+			hash := strings.ToLower(dns.HashName(name, dns.SHA1, d.Iterations, d.Salt))
+			hashes[hash] = name
+			hashed = append(hashed, hash)
+		}
+		sort.Strings(hashed)
+
+		for idx, hash := range hashed {
+			name := hashes[hash]
+			types := []uint16{}
+			if len(owners[name]) > 0 {
+				extra := []uint16{}
+				if len(signed(name)) > 0 {
+					extra = append(extra, dns.TypeRRSIG)
+				}
+				types = typeBitMap(owners[name], extra...)
+			}
+
+			add(&dns.NSEC3{
+				Hdr:        dns.RR_Header{Name: hash + "." + origin, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: negativeTtl},
+				Hash:       dns.SHA1,
+				Iterations: d.Iterations,
+				SaltLength: uint8(len(d.Salt) / 2),
+				Salt:       d.Salt,
+				HashLength: 20,
+				NextDomain: hashed[(idx+1)%len(hashed)],
+				TypeBitMap: types,
+			})
+		}
+
+		for _, hash := range hashed {
+			names = append(names, hash+"."+origin)
+		}
+		sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+	} else {
+		for idx, name := range authoritative {
+			add(&dns.NSEC{
+				Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: negativeTtl},
+				NextDomain: authoritative[(idx+1)%len(authoritative)],
+				TypeBitMap: typeBitMap(owners[name], dns.TypeNSEC, dns.TypeRRSIG),
+			})
+		}
+	}
+
+	result := []dns.RR{soa}
+	for _, name := range names {
+		for _, rr := range owners[name] {
+			if rr != dns.RR(soa) {
+				result = append(result, rr)
+			}
+		}
+		if occluded(name) {
+			continue
+		}
+
+		rrsets := make(map[uint16][]dns.RR)
+		types := []uint16{}
+		for _, rr := range signed(name) {
+			t := rr.Header().Rrtype
+			if _, ok := rrsets[t]; !ok {
+				types = append(types, t)
+			}
+			rrsets[t] = append(rrsets[t], rr)
+		}
+
+		for _, t := range types {
+			for _, k := range keys {
+				if k.isKSK() != (t == dns.TypeDNSKEY) {
+					continue
+				}
+
+				sig := &dns.RRSIG{
+					Hdr:        dns.RR_Header{Ttl: rrsets[t][0].Header().Ttl},
+					Algorithm:  k.key.Algorithm,
+					KeyTag:     k.key.KeyTag(),
+					SignerName: origin,
+					Inception:  uint32(now.Add(-signatureSkew).Unix()),
+					Expiration: uint32(now.Add(d.Validity).Unix()),
+				}
+				err := sig.Sign(k.signer, rrsets[t])
+				if err != nil {
+					return nil, fmt.Errorf("Sign %s %s: %v", name, dns.TypeToString[t], err)
+				}
+				result = append(result, sig)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// needsSigning returns true if the signed zone in fname does not exist, has
+// another serial than the unsigned zone, is signed with other keys, or
+// contains signatures which expire within Refresh of now. The serial
+// differs when signing failed after the unsigned zone was written.
+func (d *Dnssec) needsSigning(fname string, serial uint32, keys []signingKey, now time.Time) (bool, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	tags := make(map[uint16]bool)
+	for _, k := range keys {
+		tags[k.key.KeyTag()] = true
+	}
+
+	published := make(map[uint16]bool)
+	refresh := uint32(now.Add(d.Refresh).Unix())
+	zp := dns.NewZoneParser(bytes.NewReader(data), "", fname)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch v := rr.(type) {
+		case *dns.SOA:
+			if v.Serial != serial {
+				return true, nil
+			}
+		case *dns.DNSKEY:
+			published[v.KeyTag()] = true
+		case *dns.RRSIG:
+			if v.Expiration < refresh || !tags[v.KeyTag] {
+				return true, nil
+			}
+		}
+	}
+	if zp.Err() != nil {
+		return true, nil
+	}
+
+	if len(published) != len(tags) {
+		return true, nil
+	}
+	for tag := range tags {
+		if !published[tag] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// writeSigned signs the zone file data and stores the result as
+// db.<zone>.signed, together with the DS records of the key signing keys as
+// dsset-<zone>
+func (g Generator) writeSigned(zone string, data []byte, keys []signingKey) error {
+	fname := g.out + "/db." + zone + ".signed"
+
+	rrs := []dns.RR{}
+	zp := dns.NewZoneParser(bytes.NewReader(data), "", "db."+zone)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if zp.Err() != nil {
+		return fmt.Errorf("zp.Next: %v", zp.Err())
+	}
+
+	signedRRs, err := g.Dnssec.signZone(zone, rrs, keys, timeNow())
+	if err != nil {
+		return fmt.Errorf("signZone: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	ds := &bytes.Buffer{}
+	for _, rr := range signedRRs {
+		fmt.Fprintln(buf, rr.String())
+	}
+	for _, k := range keys {
+		if k.isKSK() {
+			fmt.Fprintln(ds, k.key.ToDS(dns.SHA256).String())
+		}
+	}
+
+	err = validateZone(zone, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("validateZone: %v", err)
+	}
+
+	for fname, data := range map[string][]byte{fname: buf.Bytes(), g.out + "/dsset-" + zone: ds.Bytes()} {
+		err = ioutil.WriteFile(fname+".new", data, 0644)
+		if err != nil {
+			return fmt.Errorf("ioutil.WriteFile: %v", err)
+		}
+
+		err = os.Rename(fname+".new", fname)
+		if err != nil {
+			return fmt.Errorf("os.Rename: %v", err)
+		}
+	}
+	fmt.Printf("[+] Wrote %s\n", fname)
+
+	return nil
+}
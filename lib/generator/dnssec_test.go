@@ -0,0 +1,324 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// readZoneFile parses the zone file fname
+func readZoneFile(t *testing.T, fname string) []dns.RR {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+
+	rrs := []dns.RR{}
+	zp := dns.NewZoneParser(bytes.NewReader(data), "", fname)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if zp.Err() != nil {
+		t.Fatalf("%s: %v", fname, zp.Err())
+	}
+
+	return rrs
+}
+
+// verifySignedZone checks that every authoritative RRset of the signed zone
+// origin has a valid signature at now, that the data at zone cuts is not
+// signed, and that the NSEC or NSEC3 chain covers every name exactly once
+func verifySignedZone(t *testing.T, origin string, rrs []dns.RR, now time.Time) {
+	t.Helper()
+
+	type rrsetKey struct {
+		name  string
+		rtype uint16
+	}
+
+	rrsets := make(map[rrsetKey][]dns.RR)
+	keys := make(map[uint16]*dns.DNSKEY)
+	sigs := []*dns.RRSIG{}
+	cuts := []string{}
+	for _, rr := range rrs {
+		h := rr.Header()
+		switch v := rr.(type) {
+		case *dns.RRSIG:
+			sigs = append(sigs, v)
+			continue
+		case *dns.DNSKEY:
+			keys[v.KeyTag()] = v
+		case *dns.NS:
+			if h.Name != origin {
+				cuts = append(cuts, h.Name)
+			}
+		}
+		k := rrsetKey{h.Name, h.Rrtype}
+		rrsets[k] = append(rrsets[k], rr)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("%s: expected a KSK and a ZSK, got %d keys", origin, len(keys))
+	}
+
+	signed := make(map[rrsetKey]bool)
+	for _, sig := range sigs {
+		k := rrsetKey{sig.Hdr.Name, sig.TypeCovered}
+		key, ok := keys[sig.KeyTag]
+		if !ok {
+			t.Errorf("%s: signed with unknown key %d", sig.Hdr.Name, sig.KeyTag)
+			continue
+		}
+		if (key.Flags&dns.SEP != 0) != (sig.TypeCovered == dns.TypeDNSKEY) {
+			t.Errorf("%s %s: signed with the wrong key", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered])
+		}
+		if err := sig.Verify(key, rrsets[k]); err != nil {
+			t.Errorf("%s %s: %v", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered], err)
+		}
+		if !sig.ValidityPeriod(now) {
+			t.Errorf("%s %s: signature is not valid at %s", sig.Hdr.Name, dns.TypeToString[sig.TypeCovered], now)
+		}
+		signed[k] = true
+	}
+
+	below := func(name string) (atCut, occluded bool) {
+		for _, cut := range cuts {
+			if name == cut {
+				atCut = true
+			} else if dns.IsSubDomain(cut, name) {
+				occluded = true
+			}
+		}
+		return atCut, occluded
+	}
+
+	names := make(map[string]bool)
+	for k := range rrsets {
+		atCut, occluded := below(k.name)
+		expected := !occluded && (!atCut || k.rtype == dns.TypeDS || k.rtype == dns.TypeNSEC)
+		if signed[k] != expected {
+			t.Errorf("%s %s: expected signed to be %v", k.name, dns.TypeToString[k.rtype], expected)
+		}
+		if !occluded && k.rtype != dns.TypeNSEC3 {
+			names[k.name] = true
+		}
+	}
+
+	// Follow the chain from the apex, every name is visited once
+	next := make(map[string]string)
+	nsec3s := []*dns.NSEC3{}
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.NSEC:
+			next[v.Hdr.Name] = v.NextDomain
+		case *dns.NSEC3:
+			next[v.Hdr.Name] = v.NextDomain + "." + origin
+			nsec3s = append(nsec3s, v)
+		}
+	}
+
+	start := origin
+	if len(nsec3s) > 0 {
+		start = strings.ToLower(dns.HashName(origin, dns.SHA1, nsec3s[0].Iterations, nsec3s[0].Salt)) + "." + origin
+		for name := range names {
+			found := false
+			for _, nsec3 := range nsec3s {
+				found = found || nsec3.Match(name)
+			}
+			if !found {
+				t.Errorf("%s: not covered by the NSEC3 chain", name)
+			}
+		}
+	} else if len(next) != len(names) {
+		t.Errorf("%s: expected %d NSEC records, got %d", origin, len(names), len(next))
+	}
+
+	visited := 0
+	for name := start; visited == 0 || name != start; name = next[name] {
+		if _, ok := next[name]; !ok {
+			t.Fatalf("%s: chain is broken at %s", origin, name)
+		}
+		visited++
+		if visited > len(next) {
+			t.Fatalf("%s: chain does not return to %s", origin, start)
+		}
+	}
+	if visited != len(next) {
+		t.Errorf("%s: chain visits %d of %d names", origin, visited, len(next))
+	}
+}
+
+func TestSignZones(t *testing.T) {
+	now := time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		algorithm string
+		nsec3     bool
+	}{
+		{"nsec", "ecdsap256sha256", false},
+		{"nsec3", "ed25519", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, _ := newTestGenerator(t)
+			out := g.out
+
+			algorithm, err := ParseDnssecAlgorithm(test.algorithm)
+			if err != nil {
+				t.Fatalf("ParseDnssecAlgorithm: %v", err)
+			}
+
+			g.Dnssec = &Dnssec{
+				KeyDir:     filepath.Join(out, "keys"),
+				Algorithm:  algorithm,
+				NSEC3:      test.nsec3,
+				Iterations: 1,
+				Salt:       "AABBCCDD",
+				Validity:   30 * 24 * time.Hour,
+				Refresh:    7 * 24 * time.Hour,
+			}
+
+			ctx := context.Background()
+			if err := g.ReverseDNS(ctx, ""); err != nil {
+				t.Fatalf("ReverseDNS: %v", err)
+			}
+			if err := g.ForwardDNS(ctx, ""); err != nil {
+				t.Fatalf("ForwardDNS: %v", err)
+			}
+
+			for _, zone := range []string{"as65342.net", "2.0.192.in-addr.arpa", "64-26.2.0.192.in-addr.arpa"} {
+				rrs := readZoneFile(t, filepath.Join(out, "db."+zone+".signed"))
+				verifySignedZone(t, zone+".", rrs, now)
+
+				keys, err := g.Dnssec.zoneKeys(zone)
+				if err != nil {
+					t.Fatalf("zoneKeys: %v", err)
+				}
+				for _, rr := range readZoneFile(t, filepath.Join(out, "dsset-"+zone)) {
+					ds := rr.(*dns.DS)
+					found := false
+					for _, key := range keys {
+						found = found || (key.isKSK() && strings.EqualFold(key.key.ToDS(dns.SHA256).Digest, ds.Digest))
+					}
+					if !found {
+						t.Errorf("dsset-%s: %s does not match a KSK", zone, ds)
+					}
+				}
+			}
+
+			// The unsigned zone is still written for reference
+			unsigned := readZoneFile(t, filepath.Join(out, "db.as65342.net"))
+			for _, rr := range unsigned {
+				if rr.Header().Rrtype == dns.TypeRRSIG {
+					t.Fatalf("db.as65342.net: contains signatures")
+				}
+			}
+		})
+	}
+}
+
+func TestResignZones(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	out := g.out
+	g.Dnssec = &Dnssec{
+		KeyDir:    filepath.Join(out, "keys"),
+		Algorithm: dns.ED25519,
+		Validity:  30 * 24 * time.Hour,
+		Refresh:   7 * 24 * time.Hour,
+	}
+
+	now := time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	fname := filepath.Join(out, "db.as65342.net.signed")
+	generate := func() (uint32, []byte) {
+		t.Helper()
+		if err := g.ForwardDNS(context.Background(), ""); err != nil {
+			t.Fatalf("ForwardDNS: %v", err)
+		}
+		serial, _, ok, err := readSerial(filepath.Join(out, "db.as65342.net"))
+		if err != nil || !ok {
+			t.Fatalf("readSerial: %v", err)
+		}
+		signed, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		return serial, signed
+	}
+
+	serial, signed := generate()
+	if serial != 2018010200 {
+		t.Fatalf("expected the first serial of the day, got %d", serial)
+	}
+
+	// A signed zone which is older than the unsigned zone, because signing
+	// failed after the unsigned zone was written, is signed again
+	stale := []string{}
+	for _, rr := range readZoneFile(t, fname) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			soa.Serial--
+		}
+		stale = append(stale, rr.String())
+	}
+	if err := ioutil.WriteFile(fname, []byte(strings.Join(stale, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	serial, signed = generate()
+	if serial != 2018010201 {
+		t.Errorf("expected serial 2018010201 after signing a stale zone, got %d", serial)
+	}
+	if rrs := readZoneFile(t, fname); rrs[0].(*dns.SOA).Serial != serial {
+		t.Errorf("expected the signed zone to have serial %d, got %v", serial, rrs[0])
+	}
+
+	// Signatures which are valid long enough are kept
+	now = now.Add(24 * time.Hour)
+	if next, nextSigned := generate(); next != serial || !bytes.Equal(nextSigned, signed) {
+		t.Errorf("expected the signed zone to be unchanged, got serial %d", next)
+	}
+
+	// Signatures which expire within the refresh interval are renewed,
+	// which needs a new serial
+	now = now.Add(23 * 24 * time.Hour)
+	next, _ := generate()
+	if next != 2018012600 {
+		t.Errorf("expected serial 2018012600 after re-signing, got %d", next)
+	}
+	verifySignedZone(t, "as65342.net.", readZoneFile(t, fname), now)
+
+	// Adding a key publishes it and signs the zone again
+	keys, err := g.Dnssec.zoneKeys("as65342.net")
+	if err != nil {
+		t.Fatalf("zoneKeys: %v", err)
+	}
+	if _, err := g.Dnssec.generateKey("as65342.net.", dns.ZONE); err != nil {
+		t.Fatalf("generateKey: %v", err)
+	}
+	if last, _ := generate(); last != next+1 {
+		t.Errorf("expected serial %d after adding a key, got %d", next+1, last)
+	}
+
+	published := 0
+	for _, rr := range readZoneFile(t, fname) {
+		if rr.Header().Rrtype == dns.TypeDNSKEY {
+			published++
+		}
+	}
+	if published != len(keys)+1 {
+		t.Errorf("expected %d published keys, got %d", len(keys)+1, published)
+	}
+}
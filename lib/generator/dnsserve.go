@@ -0,0 +1,709 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+const (
+	// maxHistory is the number of changes kept per zone to answer IXFR
+	// requests with, older serials receive the complete zone
+	maxHistory = 16
+	// transferChunkSize is the number of records sent per message during
+	// zone transfers
+	transferChunkSize = 100
+)
+
+// AuthServer is an authoritative nameserver which serves the forward and
+// reverse zones straight from NetBox
+type AuthServer struct {
+	// Address is the address on which to listen for both udp and tcp
+	// queries. Listener and PacketConn are used instead when set.
+	Address    string
+	Listener   net.Listener
+	PacketConn net.PacketConn
+
+	// Refresh is the interval at which the zones are rebuilt from NetBox
+	Refresh time.Duration
+	// Timeout is used when sending NOTIFY messages
+	Timeout time.Duration
+
+	// AllowTransfer contains the networks which can transfer the zones.
+	// Requests signed with Tsig are always allowed to transfer.
+	AllowTransfer []*net.IPNet
+	Tsig          *Tsig
+
+	// Notify contains the host:port of every secondary which is notified
+	// when the serial of a zone changes
+	Notify []string
+
+	// StateFile keeps the serial of every zone across restarts, so the
+	// serials served after a restart are higher than the ones known by
+	// the secondaries
+	StateFile string
+
+	mutex   sync.RWMutex
+	zones   map[string]*servedZone
+	serials map[string]uint32
+}
+
+// zoneDelta contains the changes between two versions of a zone
+type zoneDelta struct {
+	from, to       *dns.SOA
+	removed, added []dns.RR
+}
+
+// servedZone is the current version of a zone served by AuthServer
+type servedZone struct {
+	name    string
+	soa     *dns.SOA
+	rrs     []dns.RR
+	owners  map[string][]dns.RR
+	names   map[string]bool
+	history []zoneDelta
+}
+
+func newServedZone(name string, soa *dns.SOA, rrs []dns.RR) *servedZone {
+	z := &servedZone{
+		name:   dns.Fqdn(strings.ToLower(name)),
+		soa:    soa,
+		rrs:    rrs,
+		owners: make(map[string][]dns.RR),
+		names:  make(map[string]bool),
+	}
+
+	z.owners[z.name] = []dns.RR{soa}
+	for _, rr := range rrs {
+		owner := strings.ToLower(rr.Header().Name)
+		z.owners[owner] = append(z.owners[owner], rr)
+	}
+
+	// Names exist if they own records, or if they are an empty
+	// non-terminal between the apex and an owner
+	z.names[z.name] = true
+	for owner := range z.owners {
+		labels := dns.SplitDomainName(owner)
+		for idx := range labels {
+			name := dns.Fqdn(strings.Join(labels[idx:], "."))
+			if z.names[name] || !dns.IsSubDomain(z.name, name) {
+				break
+			}
+			z.names[name] = true
+		}
+	}
+
+	return z
+}
+
+// update returns the version of z containing rrs and the settings of soa.
+// The serial is only increased if anything changed, in which case the
+// changes are kept for IXFR.
+func (z *servedZone) update(format SerialFormat, soa *dns.SOA, rrs []dns.RR) (*servedZone, bool) {
+	remove, add := diffRecords(z.rrs, rrs)
+
+	soa = dns.Copy(soa).(*dns.SOA)
+	soa.Serial = z.soa.Serial
+	if len(remove) == 0 && len(add) == 0 && soa.String() == z.soa.String() {
+		return z, false
+	}
+	soa.Serial = nextSerial(format, z.soa.Serial, timeNow())
+
+	next := newServedZone(z.name, soa, rrs)
+	next.history = append(next.history, z.history...)
+	next.history = append(next.history, zoneDelta{from: z.soa, to: soa, removed: remove, added: add})
+	if len(next.history) > maxHistory {
+		next.history = next.history[len(next.history)-maxHistory:]
+	}
+
+	return next, true
+}
+
+// axfr returns the records of a complete zone transfer
+func (z *servedZone) axfr() []dns.RR {
+	rrs := []dns.RR{z.soa}
+	rrs = append(rrs, z.rrs...)
+	return append(rrs, z.soa)
+}
+
+// ixfr returns the records of an incremental zone transfer for a secondary
+// at serial. The complete zone is returned if the changes since serial are
+// no longer known.
+func (z *servedZone) ixfr(serial uint32) []dns.RR {
+	if serial == z.soa.Serial {
+		return []dns.RR{z.soa}
+	}
+
+	for idx, delta := range z.history {
+		if delta.from.Serial != serial {
+			continue
+		}
+
+		rrs := []dns.RR{z.soa}
+		for _, delta := range z.history[idx:] {
+			rrs = append(rrs, delta.from)
+			rrs = append(rrs, delta.removed...)
+			rrs = append(rrs, delta.to)
+			rrs = append(rrs, delta.added...)
+		}
+		return append(rrs, z.soa)
+	}
+
+	return z.axfr()
+}
+
+// negative returns the SOA record to add to negative answers, with the TTL
+// set according to RFC 2308
+func (z *servedZone) negative() dns.RR {
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return soa
+}
+
+// exists returns true if name owns any records, or is an empty
+// non-terminal above names which do
+func (z *servedZone) exists(name string) bool {
+	return z.names[name]
+}
+
+// wildcard returns the records of the wildcard matching name, which does
+// not exist, with their owner replaced by name, see RFC 4592. It returns
+// nil if the closest encloser of name has no wildcard.
+func (z *servedZone) wildcard(name string) []dns.RR {
+	labels := dns.SplitDomainName(name)
+	for idx := 1; idx < len(labels); idx++ {
+		encloser := dns.Fqdn(strings.Join(labels[idx:], "."))
+		if !dns.IsSubDomain(z.name, encloser) {
+			return nil
+		}
+		if !z.exists(encloser) {
+			continue
+		}
+
+		rrs := []dns.RR{}
+		for _, rr := range z.owners["*."+encloser] {
+			rr = dns.Copy(rr)
+			rr.Header().Name = name
+			rrs = append(rrs, rr)
+		}
+		if len(rrs) == 0 {
+			return nil
+		}
+		return rrs
+	}
+
+	return nil
+}
+
+// delegation returns the NS records of the highest zone cut between the
+// apex and name, if any
+func (z *servedZone) delegation(name string, qtype uint16) []dns.RR {
+	labels := dns.SplitDomainName(name)
+	apexLabels := dns.CountLabel(z.name)
+
+	for idx := len(labels) - apexLabels - 1; idx >= 0; idx-- {
+		cut := dns.Fqdn(strings.Join(labels[idx:], "."))
+		if cut == name && qtype == dns.TypeDS {
+			// DS records are served by the parent side of the cut
+			return nil
+		}
+
+		ns := []dns.RR{}
+		for _, rr := range z.owners[cut] {
+			if rr.Header().Rrtype == dns.TypeNS {
+				ns = append(ns, rr)
+			}
+		}
+		if len(ns) > 0 {
+			return ns
+		}
+	}
+
+	return nil
+}
+
+// addresses returns the in-zone A and AAAA records of every target of rrs
+func (z *servedZone) addresses(rrs []dns.RR) []dns.RR {
+	extra := []dns.RR{}
+	for _, rr := range rrs {
+		target := ""
+		switch v := rr.(type) {
+		case *dns.NS:
+			target = v.Ns
+		case *dns.MX:
+			target = v.Mx
+		case *dns.SRV:
+			target = v.Target
+		default:
+			continue
+		}
+
+		for _, trr := range z.owners[strings.ToLower(target)] {
+			switch trr.Header().Rrtype {
+			case dns.TypeA, dns.TypeAAAA:
+				extra = append(extra, trr)
+			}
+		}
+	}
+	return extra
+}
+
+// answer fills in the response m to the query q, which is for a name
+// within the zone
+func (z *servedZone) answer(m *dns.Msg, q dns.Question) {
+	name := strings.ToLower(q.Name)
+
+	if ns := z.delegation(name, q.Qtype); ns != nil {
+		m.Ns = append(m.Ns, ns...)
+		m.Extra = append(m.Extra, z.addresses(ns)...)
+		return
+	}
+	m.Authoritative = true
+
+	for i := 0; i < maxAliases; i++ {
+		// Aliases pointing below a zone cut, like the RFC 2317 CNAMEs in
+		// reverse zones, are left to the resolver
+		if i > 0 && z.delegation(name, q.Qtype) != nil {
+			return
+		}
+
+		rrs := z.owners[name]
+		if !z.exists(name) {
+			if rrs = z.wildcard(name); rrs == nil {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = append(m.Ns, z.negative())
+				return
+			}
+		}
+
+		answer := []dns.RR{}
+		alias := ""
+		for _, rr := range rrs {
+			switch {
+			case rr.Header().Rrtype == q.Qtype, q.Qtype == dns.TypeANY:
+				answer = append(answer, rr)
+			case rr.Header().Rrtype == dns.TypeCNAME:
+				alias = strings.ToLower(rr.(*dns.CNAME).Target)
+				answer = append(answer, rr)
+			}
+		}
+
+		m.Answer = append(m.Answer, answer...)
+		if len(answer) == 0 {
+			m.Ns = append(m.Ns, z.negative())
+			return
+		}
+
+		if alias == "" || !dns.IsSubDomain(z.name, alias) {
+			m.Extra = append(m.Extra, z.addresses(answer)...)
+			return
+		}
+		name = alias
+	}
+}
+
+// tsig returns the secrets and fully qualified key name and algorithm to
+// use with the miekg/dns server, or nil if no key is configured
+func (s *AuthServer) tsig() (secrets map[string]string, name, algorithm string) {
+	return DnsServer{Tsig: s.Tsig}.tsig()
+}
+
+// zone returns the most specific zone containing name
+func (s *AuthServer) zone(name string) *servedZone {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var found *servedZone
+	for zoneName, z := range s.zones {
+		if !dns.IsSubDomain(zoneName, name) {
+			continue
+		}
+		if found == nil || dns.CountLabel(zoneName) > dns.CountLabel(found.name) {
+			found = z
+		}
+	}
+
+	return found
+}
+
+// transferAllowed returns true if the client sending r is allowed to
+// transfer zones
+func (s *AuthServer) transferAllowed(w dns.ResponseWriter, r *dns.Msg) bool {
+	if s.Tsig != nil && r.IsTsig() != nil && w.TsigStatus() == nil {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(w.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+
+	address := net.ParseIP(host)
+	for _, network := range s.AllowTransfer {
+		if network.Contains(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// transfer sends rrs to the client in as many messages as needed
+func (s *AuthServer) transfer(w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR) {
+	envelopes := make(chan *dns.Envelope, len(rrs)/transferChunkSize+1)
+	for len(rrs) > 0 {
+		size := transferChunkSize
+		if size > len(rrs) {
+			size = len(rrs)
+		}
+		envelopes <- &dns.Envelope{RR: rrs[:size]}
+		rrs = rrs[size:]
+	}
+	close(envelopes)
+
+	t := new(dns.Transfer)
+	if err := t.Out(w, r, envelopes); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: transfer of %s to %s: %v\n", r.Question[0].Name, w.RemoteAddr(), err)
+	}
+}
+
+// ServeDNS answers a single query, which makes AuthServer a dns.Handler
+func (s *AuthServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	tsig := r.IsTsig()
+	if tsig != nil {
+		if w.TsigStatus() != nil {
+			m.SetRcode(r, dns.RcodeNotAuth)
+			w.WriteMsg(m)
+			return
+		}
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+
+	if r.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		w.WriteMsg(m)
+		return
+	}
+
+	q := r.Question[0]
+	z := s.zone(strings.ToLower(q.Name))
+	if z == nil {
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+
+	switch q.Qtype {
+	case dns.TypeAXFR, dns.TypeIXFR:
+		if !s.transferAllowed(w, r) || strings.ToLower(q.Name) != z.name {
+			m.SetRcode(r, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+
+		if q.Qtype == dns.TypeAXFR {
+			if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+				m.SetRcode(r, dns.RcodeRefused)
+				w.WriteMsg(m)
+				return
+			}
+			s.transfer(w, r, z.axfr())
+			return
+		}
+
+		if len(r.Ns) != 1 {
+			m.SetRcode(r, dns.RcodeFormatError)
+			w.WriteMsg(m)
+			return
+		}
+		current, ok := r.Ns[0].(*dns.SOA)
+		if !ok {
+			m.SetRcode(r, dns.RcodeFormatError)
+			w.WriteMsg(m)
+			return
+		}
+
+		// Over udp only the current SOA is sent, which tells the
+		// secondary to retry using tcp if it is out of date
+		if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+			m.Authoritative = true
+			m.Answer = []dns.RR{z.soa}
+			w.WriteMsg(m)
+			return
+		}
+		s.transfer(w, r, z.ixfr(current.Serial))
+		return
+	}
+
+	z.answer(m, q)
+	m.Compress = true
+	w.WriteMsg(m)
+}
+
+// notify sends a NOTIFY for zone to every secondary
+func (s *AuthServer) notify(zone *servedZone) {
+	secrets, keyName, algorithm := s.tsig()
+
+	for _, target := range s.Notify {
+		m := new(dns.Msg)
+		m.SetNotify(zone.name)
+		m.Answer = []dns.RR{zone.soa}
+		if secrets != nil {
+			m.SetTsig(keyName, algorithm, 300, time.Now().Unix())
+		}
+
+		c := &dns.Client{
+			Timeout:    s.Timeout,
+			TsigSecret: secrets,
+		}
+
+		r, _, err := c.Exchange(m, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: notify %s to %s: %v\n", zone.name, target, err)
+			continue
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			fmt.Fprintf(os.Stderr, "WARNING: notify %s to %s: %s\n", zone.name, target, dns.RcodeToString[r.Rcode])
+		}
+	}
+}
+
+// refresh rebuilds all zones from NetBox, and returns the zones of which
+// the serial changed
+func (s *AuthServer) refresh(ctx context.Context, g Generator) ([]*servedZone, error) {
+	g.client.Invalidate(netboxclient.Prefixes, netboxclient.IpAddresses, netboxclient.ConfigContexts,
+		netboxclient.Services, netboxclient.Devices, netboxclient.VirtualMachines)
+
+	reverseZones, err := g.reverseZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reverseZones: %v", err)
+	}
+
+	forwardZones, err := g.forwardZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("forwardZones: %v", err)
+	}
+
+	reverseTemplate, forwardTemplate, err := zoneTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("zoneTemplates: %v", err)
+	}
+
+	s.mutex.RLock()
+	current := s.zones
+	s.mutex.RUnlock()
+
+	zones := make(map[string]*servedZone)
+	changed := []*servedZone{}
+	build := func(t *template.Template, zone Zone) error {
+		soa, rrs, err := zoneRecords(t, zone)
+		if err != nil {
+			return fmt.Errorf("zoneRecords %s: %v", zone.Name, err)
+		}
+
+		name := dns.Fqdn(strings.ToLower(zone.Name))
+		z, ok := current[name]
+		if !ok {
+			soa.Serial = nextSerial(g.SerialFormat, s.serials[name], timeNow())
+			z = newServedZone(name, soa, rrs)
+		} else if z, ok = z.update(g.SerialFormat, soa, rrs); !ok {
+			zones[name] = z
+			return nil
+		}
+
+		zones[name] = z
+		changed = append(changed, z)
+		return nil
+	}
+
+	for _, zone := range reverseZones {
+		if err := build(reverseTemplate, zone); err != nil {
+			return nil, err
+		}
+	}
+	for _, zone := range forwardZones {
+		if err := build(forwardTemplate, zone); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mutex.Lock()
+	s.zones = zones
+	s.mutex.Unlock()
+
+	if len(changed) > 0 {
+		for _, z := range changed {
+			s.serials[z.name] = z.soa.Serial
+		}
+		if err := s.saveSerials(); err != nil {
+			return nil, fmt.Errorf("saveSerials: %v", err)
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i].name < changed[j].name })
+	for _, z := range changed {
+		fmt.Printf("[+] Serving %s with serial %d\n", strings.TrimSuffix(z.name, "."), z.soa.Serial)
+	}
+
+	return changed, nil
+}
+
+// loadSerials reads the serials stored in StateFile. Without a state file,
+// or when it does not exist yet, there are no serials.
+func (s *AuthServer) loadSerials() error {
+	s.serials = make(map[string]uint32)
+	if s.StateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	err = json.Unmarshal(data, &s.serials)
+	if err != nil {
+		return fmt.Errorf("%s: json.Unmarshal: %v", s.StateFile, err)
+	}
+
+	return nil
+}
+
+// saveSerials stores the last serial of every zone which was served in
+// StateFile, including zones which are no longer served
+func (s *AuthServer) saveSerials() error {
+	if s.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.serials, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %v", err)
+	}
+
+	err = common.CreateDirIfNotExists(filepath.Dir(s.StateFile))
+	if err != nil {
+		return fmt.Errorf("CreateDirIfNotExists: %v", err)
+	}
+
+	err = ioutil.WriteFile(s.StateFile+".new", data, 0644)
+	if err != nil {
+		return fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+
+	err = os.Rename(s.StateFile+".new", s.StateFile)
+	if err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+
+	return nil
+}
+
+// ServeZones answers queries and zone transfers for the forward and reverse
+// zones until ctx is cancelled. The zones are rebuilt from NetBox every
+// Refresh, and the secondaries are notified of every zone which changed.
+// Serials continue from the ones stored in StateFile. Without a state file
+// they start from the current time, which is only safe across restarts
+// with unix serials.
+func (g Generator) ServeZones(ctx context.Context, s *AuthServer) error {
+	if err := s.loadSerials(); err != nil {
+		return fmt.Errorf("loadSerials: %v", err)
+	}
+
+	refreshCtx, cancel := context.WithTimeout(ctx, s.Refresh)
+	changed, err := s.refresh(refreshCtx, g)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("refresh: %v", err)
+	}
+
+	if s.Listener == nil {
+		s.Listener, err = net.Listen("tcp", s.Address)
+		if err != nil {
+			return fmt.Errorf("net.Listen: %v", err)
+		}
+	}
+	if s.PacketConn == nil {
+		s.PacketConn, err = net.ListenPacket("udp", s.Address)
+		if err != nil {
+			s.Listener.Close()
+			return fmt.Errorf("net.ListenPacket: %v", err)
+		}
+	}
+
+	secrets, _, _ := s.tsig()
+	servers := []*dns.Server{
+		{Listener: s.Listener, Handler: s, TsigSecret: secrets},
+		{PacketConn: s.PacketConn, Handler: s, TsigSecret: secrets},
+	}
+
+	failed := make(chan error, len(servers))
+	for _, server := range servers {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go func(server *dns.Server) {
+			failed <- server.ActivateAndServe()
+		}(server)
+
+		select {
+		case <-started:
+		case err := <-failed:
+			return fmt.Errorf("ActivateAndServe: %v", err)
+		}
+	}
+	defer func() {
+		for _, server := range servers {
+			server.Shutdown()
+		}
+	}()
+
+	for _, z := range changed {
+		go s.notify(z)
+	}
+
+	ticker := time.NewTicker(s.Refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-failed:
+			return fmt.Errorf("ActivateAndServe: %v", err)
+		case <-ticker.C:
+			refreshCtx, cancel := context.WithTimeout(ctx, s.Refresh)
+			changed, err := s.refresh(refreshCtx, g)
+			cancel()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: refresh: %v\n", err)
+				continue
+			}
+
+			for _, z := range changed {
+				go s.notify(z)
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// notifyListener records the NOTIFY messages it receives
+type notifyListener struct {
+	*dns.Server
+	notifies chan *dns.SOA
+}
+
+func newNotifyListener(t *testing.T) *notifyListener {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+
+	l := &notifyListener{notifies: make(chan *dns.SOA, 100)}
+	l.Server = &dns.Server{
+		PacketConn: conn,
+		TsigSecret: map[string]string{testTsigName: testTsigSecret},
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				m.SetRcode(r, dns.RcodeNotAuth)
+			} else if soa, ok := r.Answer[0].(*dns.SOA); ok {
+				l.notifies <- soa
+				m.SetTsig(testTsigName, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			w.WriteMsg(m)
+		}),
+	}
+
+	started := make(chan struct{})
+	l.NotifyStartedFunc = func() { close(started) }
+	go l.ActivateAndServe()
+	<-started
+
+	t.Cleanup(func() { l.Shutdown() })
+
+	return l
+}
+
+// waitForNotify returns the SOA of the first NOTIFY received for zone
+func (l *notifyListener) waitForNotify(t *testing.T, zone string) *dns.SOA {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case soa := <-l.notifies:
+			if soa.Hdr.Name == zone {
+				return soa
+			}
+		case <-timeout:
+			t.Fatalf("no NOTIFY received for %s", zone)
+		}
+	}
+}
+
+func TestServeZones(t *testing.T) {
+	g, server := newTestGenerator(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	conn, err := net.ListenPacket("udp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("net.ListenPacket: %v", err)
+	}
+
+	secondary := newNotifyListener(t)
+	s := &AuthServer{
+		Listener:   listener,
+		PacketConn: conn,
+		Refresh:    50 * time.Millisecond,
+		Timeout:    time.Second,
+		Tsig:       &Tsig{Name: "netbox", Secret: testTsigSecret},
+		Notify:     []string{secondary.PacketConn.LocalAddr().String()},
+	}
+	address := listener.Addr().String()
+
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- g.ServeZones(ctx, s) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeZones: %v", err)
+		}
+	}()
+
+	soa := secondary.waitForNotify(t, "as65342.net.")
+	if soa.Serial != 2018010200 {
+		t.Errorf("serial: expected 2018010200, got %d", soa.Serial)
+	}
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		r, err := dns.Exchange(m, address)
+		if err != nil {
+			t.Fatalf("dns.Exchange: %v", err)
+		}
+		return r
+	}
+
+	r := query("SERVER01.as65342.net.", dns.TypeA)
+	if !r.Authoritative || len(r.Answer) != 1 || r.Answer[0].(*dns.A).A.String() != "192.0.2.10" {
+		t.Errorf("server01 A: got %v", r)
+	}
+
+	r = query("www.as65342.net.", dns.TypeAAAA)
+	if len(r.Answer) != 2 || r.Answer[0].Header().Rrtype != dns.TypeCNAME || r.Answer[1].(*dns.AAAA).AAAA.String() != "2001:db8:42::10" {
+		t.Errorf("www AAAA: expected the CNAME to be followed, got %v", r)
+	}
+
+	r = query("as65342.net.", dns.TypeMX)
+	if len(r.Answer) != 1 || len(r.Extra) != 1 || r.Extra[0].(*dns.A).A.String() != "192.0.2.25" {
+		t.Errorf("as65342.net MX: expected the address of the exchanger, got %v", r)
+	}
+
+	r = query("missing.as65342.net.", dns.TypeA)
+	if r.Rcode != dns.RcodeNameError || len(r.Ns) != 1 || r.Ns[0].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("missing A: expected NXDOMAIN with SOA, got %v", r)
+	}
+
+	r = query("server01.as65342.net.", dns.TypeMX)
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 0 || len(r.Ns) != 1 {
+		t.Errorf("server01 MX: expected NODATA, got %v", r)
+	}
+
+	r = query("70.2.0.192.in-addr.arpa.", dns.TypePTR)
+	if len(r.Answer) != 1 || r.Answer[0].(*dns.CNAME).Target != "70.64-26.2.0.192.in-addr.arpa." {
+		t.Errorf("70.2.0.192.in-addr.arpa PTR: expected the RFC 2317 CNAME, got %v", r)
+	}
+
+	r = query("70.64-26.2.0.192.in-addr.arpa.", dns.TypePTR)
+	if !r.Authoritative || len(r.Answer) != 1 || r.Answer[0].(*dns.PTR).Ptr != "lb01.as65342.net." {
+		t.Errorf("70.64-26.2.0.192.in-addr.arpa PTR: got %v", r)
+	}
+
+	// Unallocated addresses are answered by the wildcard of the zone
+	r = query("5.2.0.192.in-addr.arpa.", dns.TypePTR)
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 1 || r.Answer[0].Header().Name != "5.2.0.192.in-addr.arpa." || r.Answer[0].(*dns.PTR).Ptr != "unallocated.as65342.net." {
+		t.Errorf("5.2.0.192.in-addr.arpa PTR: expected the wildcard, got %v", r)
+	}
+
+	r = query("5.2.0.192.in-addr.arpa.", dns.TypeA)
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 0 || len(r.Ns) != 1 {
+		t.Errorf("5.2.0.192.in-addr.arpa A: expected NODATA, got %v", r)
+	}
+
+	r = query("www.example.com.", dns.TypeA)
+	if r.Rcode != dns.RcodeRefused {
+		t.Errorf("www.example.com A: expected REFUSED, got %v", r)
+	}
+
+	transfer := func(m *dns.Msg, signed bool) ([]dns.RR, error) {
+		t.Helper()
+		tr := new(dns.Transfer)
+		if signed {
+			tr.TsigSecret = map[string]string{testTsigName: testTsigSecret}
+			m.SetTsig(testTsigName, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+		envelopes, err := tr.In(m, address)
+		if err != nil {
+			return nil, err
+		}
+		rrs := []dns.RR{}
+		for envelope := range envelopes {
+			if envelope.Error != nil {
+				return nil, envelope.Error
+			}
+			rrs = append(rrs, envelope.RR...)
+		}
+		return rrs, nil
+	}
+
+	axfr := new(dns.Msg)
+	axfr.SetAxfr("as65342.net.")
+	if _, err := transfer(axfr, false); err == nil {
+		t.Errorf("AXFR: expected an unsigned transfer to be refused")
+	}
+
+	axfr = new(dns.Msg)
+	axfr.SetAxfr("as65342.net.")
+	rrs, err := transfer(axfr, true)
+	if err != nil {
+		t.Fatalf("AXFR: %v", err)
+	}
+	if len(rrs) != 32 || rrs[0].Header().Rrtype != dns.TypeSOA || rrs[len(rrs)-1].Header().Rrtype != dns.TypeSOA {
+		t.Errorf("AXFR: expected 32 records between SOAs, got %d", len(rrs))
+	}
+
+	// Removing an address from NetBox bumps the serial of the zones it
+	// appears in, and the change is available using IXFR
+	ips := []json.RawMessage{}
+	for _, object := range server.Objects("/ipam/ip-addresses/") {
+		if !strings.Contains(string(object), `"192.0.2.70/26"`) {
+			ips = append(ips, object)
+		}
+	}
+	server.SetObjects("/ipam/ip-addresses/", ips)
+
+	updated := secondary.waitForNotify(t, "as65342.net.")
+	if updated.Serial != soa.Serial+1 {
+		t.Errorf("serial: expected %d, got %d", soa.Serial+1, updated.Serial)
+	}
+
+	ixfr := new(dns.Msg)
+	ixfr.SetIxfr("as65342.net.", soa.Serial, soa.Ns, soa.Mbox)
+	rrs, err = transfer(ixfr, true)
+	if err != nil {
+		t.Fatalf("IXFR: %v", err)
+	}
+
+	expected := []string{
+		"SOA 2018010201",
+		"SOA 2018010200",
+		"A lb01.as65342.net. 192.0.2.70",
+		"SOA 2018010201",
+		"SOA 2018010201",
+	}
+	got := []string{}
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.SOA:
+			got = append(got, fmt.Sprintf("SOA %d", v.Serial))
+		case *dns.A:
+			got = append(got, "A "+v.Hdr.Name+" "+v.A.String())
+		default:
+			got = append(got, rr.String())
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("IXFR: expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	r = query("lb01.as65342.net.", dns.TypeA)
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 0 {
+		t.Errorf("lb01 A: expected the address to be removed, got %v", r)
+	}
+}
+
+func TestServeZonesStateFile(t *testing.T) {
+	g, _ := newTestGenerator(t)
+
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC) }
+
+	// Every start serves the zones with a serial higher than the one of
+	// the previous start on the same day
+	stateFile := filepath.Join(t.TempDir(), "state", "serve.serials")
+	for _, expected := range []uint32{2018010200, 2018010201} {
+		s := &AuthServer{StateFile: stateFile}
+		if err := s.loadSerials(); err != nil {
+			t.Fatalf("loadSerials: %v", err)
+		}
+		if _, err := s.refresh(context.Background(), *g); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if serial := s.zones["as65342.net."].soa.Serial; serial != expected {
+			t.Errorf("serial: expected %d, got %d", expected, serial)
+		}
+	}
+}
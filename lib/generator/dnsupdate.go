@@ -0,0 +1,290 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Tsig contains the key used to sign zone transfers and updates
+type Tsig struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+// DnsServer is a primary nameserver which accepts dynamic updates
+type DnsServer struct {
+	Address string
+	Tsig    *Tsig
+	Timeout time.Duration
+}
+
+// serverManagedTypes are the record types which are maintained by the
+// nameserver itself, and which are never part of an update
+var serverManagedTypes = map[uint16]bool{
+	dns.TypeSOA:        true,
+	dns.TypeRRSIG:      true,
+	dns.TypeNSEC:       true,
+	dns.TypeNSEC3:      true,
+	dns.TypeNSEC3PARAM: true,
+	dns.TypeDNSKEY:     true,
+	dns.TypeCDS:        true,
+	dns.TypeCDNSKEY:    true,
+	65534:              true,
+}
+
+// tsig returns the secrets and fully qualified key name and algorithm to
+// use with the miekg/dns client, or nil if no key is configured
+func (s DnsServer) tsig() (secrets map[string]string, name, algorithm string) {
+	if s.Tsig == nil {
+		return nil, "", ""
+	}
+
+	name = dns.Fqdn(strings.ToLower(s.Tsig.Name))
+	algorithm = dns.HmacSHA256
+	if s.Tsig.Algorithm != "" {
+		algorithm = dns.Fqdn(strings.ToLower(s.Tsig.Algorithm))
+	}
+
+	return map[string]string{name: s.Tsig.Secret}, name, algorithm
+}
+
+// zoneTemplates returns the templates used to render reverse and forward
+// zones
+func zoneTemplates() (reverse, forward *template.Template, err error) {
+	reverse, err = template.New("reverseDnsZoneTemplate").Funcs(zoneTemplateFuncs).Parse(reverseDnsZoneTemplate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("template.New: %v", err)
+	}
+
+	forward, err = template.New("forwardDnsZoneTemplate").Funcs(zoneTemplateFuncs).Parse(forwardDnsZoneTemplate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("template.New: %v", err)
+	}
+
+	return reverse, forward, nil
+}
+
+// zoneRecords renders zone using t with a serial of 1, and returns its SOA
+// and all other records, after validating the zone in the same way as
+// writeZone does
+func zoneRecords(t *template.Template, zone Zone) (*dns.SOA, []dns.RR, error) {
+	err := validateRecords(zone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("validateRecords: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, dnsZoneParams{
+		Name:     zone.Name,
+		Serial:   "1",
+		Settings: zone.Settings,
+		Records:  zone.Records,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("t.Execute: %v", err)
+	}
+
+	err = validateZone(zone.Name, buf.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("validateZone: %v", err)
+	}
+
+	var soa *dns.SOA
+	rrs := []dns.RR{}
+	zp := dns.NewZoneParser(buf, "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if v, ok := rr.(*dns.SOA); ok {
+			soa = v
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+
+	return soa, rrs, zp.Err()
+}
+
+// transferZone fetches the contents of zone from the server using AXFR, and
+// returns its SOA record and all records which are not managed by the
+// server itself
+func (s DnsServer) transferZone(zone string) (soa *dns.SOA, rrs []dns.RR, err error) {
+	secrets, keyName, algorithm := s.tsig()
+
+	t := &dns.Transfer{
+		DialTimeout:  s.Timeout,
+		ReadTimeout:  s.Timeout,
+		WriteTimeout: s.Timeout,
+		TsigSecret:   secrets,
+	}
+
+	m := new(dns.Msg)
+	m.SetAxfr(dns.Fqdn(zone))
+	if secrets != nil {
+		m.SetTsig(keyName, algorithm, 300, time.Now().Unix())
+	}
+
+	envelopes, err := t.In(m, s.Address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("t.In: %v", err)
+	}
+
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, nil, fmt.Errorf("axfr: %v", envelope.Error)
+		}
+
+		for _, rr := range envelope.RR {
+			if v, ok := rr.(*dns.SOA); ok && soa == nil {
+				soa = v
+			}
+			if !serverManagedTypes[rr.Header().Rrtype] {
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+
+	if soa == nil {
+		return nil, nil, fmt.Errorf("axfr: no SOA record received")
+	}
+
+	return soa, rrs, nil
+}
+
+// recordKey returns a key which identifies rr regardless of its TTL and of
+// the case of its owner name
+func recordKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+	rr.Header().Ttl = 0
+	return rr.String()
+}
+
+// diffRecords returns the records which need to be removed from current and
+// added to it to end up with desired. Records of which only the TTL differs
+// are both removed and added.
+func diffRecords(current, desired []dns.RR) (remove, add []dns.RR) {
+	currentByKey := make(map[string]dns.RR)
+	for _, rr := range current {
+		currentByKey[recordKey(rr)] = rr
+	}
+
+	desiredByKey := make(map[string]dns.RR)
+	for _, rr := range desired {
+		key := recordKey(rr)
+		desiredByKey[key] = rr
+
+		existing, ok := currentByKey[key]
+		if !ok {
+			add = append(add, rr)
+		} else if existing.Header().Ttl != rr.Header().Ttl {
+			remove = append(remove, existing)
+			add = append(add, rr)
+		}
+	}
+
+	for _, rr := range current {
+		if _, ok := desiredByKey[recordKey(rr)]; !ok {
+			remove = append(remove, rr)
+		}
+	}
+
+	sort.SliceStable(remove, func(i, j int) bool { return remove[i].String() < remove[j].String() })
+
+	return remove, add
+}
+
+// updateZone brings zone on the server in line with the records rendered
+// by t, using a single RFC 2136 update containing only the differences.
+// The update is only applied if the SOA did not change since the transfer.
+func (s DnsServer) updateZone(ctx context.Context, t *template.Template, zone Zone) error {
+	_, desired, err := zoneRecords(t, zone)
+	if err != nil {
+		return fmt.Errorf("zoneRecords: %v", err)
+	}
+
+	soa, current, err := s.transferZone(zone.Name)
+	if err != nil {
+		return fmt.Errorf("transferZone: %v", err)
+	}
+
+	remove, add := diffRecords(current, desired)
+	if len(remove) == 0 && len(add) == 0 {
+		fmt.Printf("[+] Unchanged %s on %s\n", zone.Name, s.Address)
+		return nil
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone.Name))
+	m.Used([]dns.RR{soa})
+	if len(remove) > 0 {
+		m.Remove(remove)
+	}
+	if len(add) > 0 {
+		m.Insert(add)
+	}
+
+	secrets, keyName, algorithm := s.tsig()
+	if secrets != nil {
+		m.SetTsig(keyName, algorithm, 300, time.Now().Unix())
+	}
+
+	c := &dns.Client{
+		Net:        "tcp",
+		Timeout:    s.Timeout,
+		TsigSecret: secrets,
+	}
+
+	r, _, err := c.ExchangeContext(ctx, m, s.Address)
+	if err != nil {
+		return fmt.Errorf("c.ExchangeContext: %v", err)
+	}
+
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update refused: %s", dns.RcodeToString[r.Rcode])
+	}
+	fmt.Printf("[+] Updated %s on %s: %d removed, %d added\n", zone.Name, s.Address, len(remove), len(add))
+
+	return nil
+}
+
+// UpdateDNS sends the forward and reverse zones to server using dynamic
+// updates, instead of writing them to zone files
+func (g Generator) UpdateDNS(ctx context.Context, server DnsServer) error {
+	reverseZones, err := g.reverseZones(ctx)
+	if err != nil {
+		return fmt.Errorf("reverseZones: %v", err)
+	}
+
+	forwardZones, err := g.forwardZones(ctx)
+	if err != nil {
+		return fmt.Errorf("forwardZones: %v", err)
+	}
+
+	reverseTemplate, forwardTemplate, err := zoneTemplates()
+	if err != nil {
+		return fmt.Errorf("zoneTemplates: %v", err)
+	}
+
+	for _, zone := range reverseZones {
+		err = server.updateZone(ctx, reverseTemplate, zone)
+		if err != nil {
+			return fmt.Errorf("updateZone %s: %v", zone.Name, err)
+		}
+	}
+
+	for _, zone := range forwardZones {
+		err = server.updateZone(ctx, forwardTemplate, zone)
+		if err != nil {
+			return fmt.Errorf("updateZone %s: %v", zone.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package generator
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testTsigName   = "netbox."
+	testTsigSecret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// updateServer is a minimal dynamic primary, which serves AXFR for every
+// zone it is asked for and applies TSIG signed updates
+type updateServer struct {
+	*dns.Server
+	mutex   sync.Mutex
+	zones   map[string][]dns.RR
+	updates map[string]*dns.Msg
+}
+
+func newUpdateServer(t *testing.T) *updateServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+
+	s := &updateServer{
+		zones:   make(map[string][]dns.RR),
+		updates: make(map[string]*dns.Msg),
+	}
+	s.Server = &dns.Server{
+		Listener:   listener,
+		TsigSecret: map[string]string{testTsigName: testTsigSecret},
+		Handler:    dns.HandlerFunc(s.handle),
+		// The default accept function refuses updates
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+
+	started := make(chan struct{})
+	s.NotifyStartedFunc = func() { close(started) }
+	go s.ActivateAndServe()
+	<-started
+
+	t.Cleanup(func() { s.Shutdown() })
+
+	return s
+}
+
+func (s *updateServer) zone(name string) []dns.RR {
+	rrs, ok := s.zones[name]
+	if !ok {
+		soa, _ := dns.NewRR(name + " 60 IN SOA ns. hostmaster. 1 3600 7200 2419200 60")
+		rrs = []dns.RR{soa}
+		s.zones[name] = rrs
+	}
+	return rrs
+}
+
+func (s *updateServer) handle(w dns.ResponseWriter, r *dns.Msg) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		m.SetRcode(r, dns.RcodeNotAuth)
+		w.WriteMsg(m)
+		return
+	}
+
+	name := strings.ToLower(r.Question[0].Name)
+	rrs := s.zone(name)
+
+	switch r.Opcode {
+	case dns.OpcodeQuery:
+		m.Answer = append(m.Answer, rrs...)
+		m.Answer = append(m.Answer, rrs[0])
+	case dns.OpcodeUpdate:
+		for _, prereq := range r.Answer {
+			if recordKey(prereq) != recordKey(rrs[0]) {
+				m.SetRcode(r, dns.RcodeNXRrset)
+				m.SetTsig(testTsigName, dns.HmacSHA256, 300, time.Now().Unix())
+				w.WriteMsg(m)
+				return
+			}
+		}
+
+		for _, rr := range r.Ns {
+			if rr.Header().Class == dns.ClassNONE {
+				rr = dns.Copy(rr)
+				rr.Header().Class = dns.ClassINET
+				key := recordKey(rr)
+				for idx := range rrs {
+					if recordKey(rrs[idx]) == key {
+						rrs = append(rrs[:idx], rrs[idx+1:]...)
+						break
+					}
+				}
+			} else {
+				rrs = append(rrs, rr)
+			}
+		}
+		rrs[0].(*dns.SOA).Serial++
+		s.zones[name] = rrs
+		s.updates[name] = r
+	}
+
+	m.SetTsig(testTsigName, dns.HmacSHA256, 300, time.Now().Unix())
+	w.WriteMsg(m)
+}
+
+func TestUpdateDNS(t *testing.T) {
+	g, _ := newTestGenerator(t)
+
+	dnsServer := newUpdateServer(t)
+	for _, record := range []string{
+		"as65342.net. 60 IN NS ns.as65342.net.",
+		"server01.as65342.net. 60 IN A 192.0.2.10",
+		"vm01.as65342.net. 3600 IN A 192.0.2.20",
+		"stale.as65342.net. 60 IN A 192.0.2.99",
+	} {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("dns.NewRR: %v", err)
+		}
+		dnsServer.zones["as65342.net."] = append(dnsServer.zone("as65342.net."), rr)
+	}
+
+	target := DnsServer{
+		Address: dnsServer.Listener.Addr().String(),
+		Tsig:    &Tsig{Name: "netbox", Algorithm: "hmac-sha256", Secret: testTsigSecret},
+		Timeout: 5 * time.Second,
+	}
+
+	err := g.UpdateDNS(context.Background(), target)
+	if err != nil {
+		t.Fatalf("UpdateDNS: %v", err)
+	}
+
+	update := dnsServer.updates["as65342.net."]
+	if update == nil {
+		t.Fatalf("no update received for as65342.net")
+	}
+
+	// Only the differences are sent: the stale record is removed, the
+	// record with a different TTL is replaced and server01 is left alone
+	removed := []string{}
+	for _, rr := range update.Ns {
+		name := rr.Header().Name
+		if rr.Header().Class == dns.ClassNONE {
+			removed = append(removed, name)
+		}
+		if name == "server01.as65342.net." && rr.Header().Rrtype == dns.TypeA {
+			t.Errorf("unchanged record was sent in the update: %s", rr)
+		}
+	}
+	if strings.Join(removed, ",") != "stale.as65342.net.,vm01.as65342.net." {
+		t.Errorf("expected stale and vm01 to be removed, got %v", removed)
+	}
+
+	// The zones on the server now match the generated zones, so running
+	// the update again does not send anything
+	dnsServer.updates = make(map[string]*dns.Msg)
+	err = g.UpdateDNS(context.Background(), target)
+	if err != nil {
+		t.Fatalf("UpdateDNS: %v", err)
+	}
+	if len(dnsServer.updates) != 0 {
+		for name, update := range dnsServer.updates {
+			t.Errorf("unexpected second update for %s:\n%s", name, update)
+		}
+	}
+
+	target.Tsig.Secret = "d3JvbmdzZWNyZXR3cm9uZ3NlY3JldA=="
+	if err := g.UpdateDNS(context.Background(), target); err == nil {
+		t.Errorf("UpdateDNS: expected an error with an invalid tsig key")
+	}
+}
+
+func TestDiffRecords(t *testing.T) {
+	parse := func(records ...string) []dns.RR {
+		rrs := []dns.RR{}
+		for _, record := range records {
+			rr, err := dns.NewRR(record)
+			if err != nil {
+				t.Fatalf("dns.NewRR: %v", err)
+			}
+			rrs = append(rrs, rr)
+		}
+		return rrs
+	}
+
+	current := parse(
+		"www.example.org. 60 IN A 192.0.2.80",
+		"MAIL.example.org. 60 IN A 192.0.2.25",
+		"old.example.org. 60 IN A 192.0.2.99",
+		"ns.example.org. 60 IN A 192.0.2.53",
+	)
+	desired := parse(
+		"www.example.org. 60 IN A 192.0.2.80",
+		"mail.example.org. 60 IN A 192.0.2.25",
+		"new.example.org. 60 IN A 192.0.2.100",
+		"ns.example.org. 3600 IN A 192.0.2.53",
+	)
+
+	remove, add := diffRecords(current, desired)
+
+	expectedRemove := []string{"ns.example.org.\t60\tIN\tA\t192.0.2.53", "old.example.org.\t60\tIN\tA\t192.0.2.99"}
+	if len(remove) != len(expectedRemove) {
+		t.Fatalf("remove: expected %v, got %v", expectedRemove, remove)
+	}
+	for idx, rr := range remove {
+		if rr.String() != expectedRemove[idx] {
+			t.Errorf("remove %d: expected %s, got %s", idx, expectedRemove[idx], rr)
+		}
+	}
+
+	expectedAdd := []string{"new.example.org.\t60\tIN\tA\t192.0.2.100", "ns.example.org.\t3600\tIN\tA\t192.0.2.53"}
+	if len(add) != len(expectedAdd) {
+		t.Fatalf("add: expected %v, got %v", expectedAdd, add)
+	}
+	for idx, rr := range add {
+		if rr.String() != expectedAdd[idx] {
+			t.Errorf("add %d: expected %s, got %s", idx, expectedAdd[idx], rr)
+		}
+	}
+}
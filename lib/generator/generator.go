@@ -1,9 +1,11 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"os/user"
 
+	"github.com/r3boot/as65342-netbox/lib/common"
 	"github.com/r3boot/as65342-netbox/lib/netboxclient"
 )
 
@@ -11,12 +13,46 @@ type Generator struct {
 	client   *netboxclient.NetboxClient
 	out      string
 	Username string
+
+	// Filters narrows down the hosts managed by the client to the hosts
+	// used by this generator. The zero value allows all hosts.
+	Filters common.Filters
+
+	// SerialFormat is used for the serials of dns zones when no serial is
+	// given explicitly
+	SerialFormat SerialFormat
+
+	// ForwardZone and ReverseZone contain the default settings of forward
+	// and reverse zones, which can be overridden per zone using Zones
+	ForwardZone common.ZoneSettings
+	ReverseZone common.ZoneSettings
+	Zones       map[string]common.ZoneSettings
+
+	// BaseURL is the url of the NetBox web interface. If it is set, the
+	// records derived from NetBox objects get a TXT record containing the
+	// url of the object.
+	BaseURL string
+
+	// Dnssec contains the settings used to sign the zone files, zones are
+	// not signed if it is nil
+	Dnssec *Dnssec
+
+	// Views contains the views for which zone files are written, each in
+	// a directory named after the view. Without views, the zones contain
+	// every address and are written to the output directory.
+	Views []View
+
+	// view is the view of which the zones are built, nil for all
+	// addresses, see viewGenerators
+	view *View
 }
 
 func NewGenerator(c *netboxclient.NetboxClient, output string) (*Generator, error) {
 	g := &Generator{
-		client: c,
-		out:    output,
+		client:      c,
+		out:         output,
+		ForwardZone: common.DefaultForwardZoneSettings(),
+		ReverseZone: common.DefaultReverseZoneSettings(),
 	}
 
 	u, err := user.Current()
@@ -31,3 +67,21 @@ func NewGenerator(c *netboxclient.NetboxClient, output string) (*Generator, erro
 
 	return g, nil
 }
+
+// hostList returns the hosts managed by the client which are allowed by
+// the filters of the generator
+func (g *Generator) hostList(ctx context.Context) ([]common.ManagedDevice, error) {
+	allHosts, err := g.client.GetHostList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetHostList: %v", err)
+	}
+
+	hosts := []common.ManagedDevice{}
+	for _, host := range allHosts {
+		if g.Filters.IsAllowedDevice(host) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,218 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/config"
+	"github.com/r3boot/as65342-netbox/lib/netboxtest"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata")
+
+const testSerial = "2018010101"
+
+// testNameserverConfig is used for the configuration of every supported
+// nameserver
+var testNameserverConfig = NameserverConfig{
+	Formats:       []string{NameserverBind, NameserverNsd, NameserverKnot},
+	ZoneDir:       "/var/named/generated/",
+	Primaries:     []string{"192.0.2.53", "[2001:db8:42::53]:5353"},
+	AllowTransfer: []string{"192.0.2.54", "2001:db8:42::/64"},
+	AlsoNotify:    []string{"192.0.2.54", "[2001:db8:42::54]:5353"},
+	TsigKey:       "netbox",
+}
+
+// ansibleFilters are the default filters of the ansible generator
+var ansibleFilters = config.Default().Generators.Ansible.Filters
+
+var generatorTests = []struct {
+	name    string
+	run     func(g *Generator, ctx context.Context) error
+	filters common.Filters
+}{
+	{"AnsibleInventory", (*Generator).AnsibleInventory, ansibleFilters},
+	{"AnsibleGroupVars", (*Generator).AnsibleGroupVars, ansibleFilters},
+	{"AnsibleHostVars", (*Generator).AnsibleHostVars, ansibleFilters},
+	{"ReverseDNS", func(g *Generator, ctx context.Context) error {
+		return g.ReverseDNS(ctx, testSerial)
+	}, common.Filters{}},
+	{"ForwardDNS", func(g *Generator, ctx context.Context) error {
+		return g.ForwardDNS(ctx, testSerial)
+	}, common.Filters{}},
+	{"NameserverConfig", func(g *Generator, ctx context.Context) error {
+		return g.NameserverConfig(ctx, testNameserverConfig)
+	}, common.Filters{}},
+	{"LocalDNS", func(g *Generator, ctx context.Context) error {
+		return g.LocalDNS(ctx, []string{LocalUnbound, LocalDnsmasq})
+	}, common.Filters{}},
+	{"Icinga2Config", (*Generator).Icinga2Config, common.Filters{}},
+	{"RundeckHosts", (*Generator).RundeckHosts, common.Filters{}},
+	{"BackupHosts", (*Generator).BackupHosts, common.Filters{}},
+}
+
+// newTestGenerator returns a Generator which writes to a temporary directory,
+// and the fake NetBox server it talks to
+func newTestGenerator(t *testing.T) (*Generator, *netboxtest.Server) {
+	t.Helper()
+
+	server, err := netboxtest.NewServer(netboxtest.FixtureDir())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	c, err := server.Client(100)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	g, err := NewGenerator(c, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewGenerator: %v", err)
+	}
+
+	return g, server
+}
+
+func TestGenerators(t *testing.T) {
+	for _, test := range generatorTests {
+		t.Run(test.name, func(t *testing.T) {
+			g, _ := newTestGenerator(t)
+			out := g.out
+			g.Filters = test.filters
+
+			err := test.run(g, context.Background())
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			golden := filepath.Join("testdata", test.name)
+			if *update {
+				updateGolden(t, out, golden)
+			}
+			compareGolden(t, out, golden)
+		})
+	}
+}
+
+// readTree returns the contents of all files below dir, indexed by their
+// path relative to dir
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("filepath.Walk: %v", err)
+	}
+
+	return files
+}
+
+func updateGolden(t *testing.T, out, golden string) {
+	t.Helper()
+
+	err := os.RemoveAll(golden)
+	if err != nil {
+		t.Fatalf("os.RemoveAll: %v", err)
+	}
+
+	for name, data := range readTree(t, out) {
+		fname := filepath.Join(golden, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(fname), 0755)
+		if err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+
+		err = ioutil.WriteFile(fname, data, 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+}
+
+func compareGolden(t *testing.T, out, golden string) {
+	t.Helper()
+
+	got := readTree(t, out)
+	expected := readTree(t, golden)
+
+	names := []string{}
+	for name := range got {
+		names = append(names, name)
+	}
+	for name := range expected {
+		if _, ok := got[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		gotData, inGot := got[name]
+		expectedData, inExpected := expected[name]
+
+		switch {
+		case !inExpected:
+			t.Errorf("unexpected output file %s (run with -update to accept)", name)
+		case !inGot:
+			t.Errorf("missing output file %s", name)
+		case !bytes.Equal(gotData, expectedData):
+			t.Errorf("%s differs from golden file (run with -update to accept)\n--- got:\n%s\n--- expected:\n%s", name, gotData, expectedData)
+		}
+	}
+}
+
+func TestGeneratorFilters(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	g.client.SetFilters(common.Filters{
+		Tenants:  common.Filter{Include: []string{"*"}},
+		Statuses: common.Filter{Exclude: []string{"Offline"}},
+	})
+	g.Filters.Platforms = common.Filter{Include: []string{"c*"}, Exclude: []string{"coreos"}}
+
+	hosts, err := g.hostList(context.Background())
+	if err != nil {
+		t.Fatalf("hostList: %v", err)
+	}
+
+	names := []string{}
+	for _, host := range hosts {
+		names = append(names, host.Name)
+	}
+	sort.Strings(names)
+
+	expected := []string{"server01.as65342.net", "vm02.as65342.net", "www.example.com"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("hostList: expected %v, got %v", expected, names)
+	}
+}
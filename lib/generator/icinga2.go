@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"os"
@@ -115,15 +116,22 @@ apply Dependency "service-to-gw-{{ .PrintableAddress }}" to Service {
 {{- range .Devices }}
 object Host "{{ .Name }}" { 
   import "{{ .Tenant }}-host"
-
+{{ if .HasIPv6 }}
   address6 = "{{ .PrimaryIP6 }}"
+{{- end }}
+{{- if .HasIPv4 }}
   address = "{{ .PrimaryIP4 }}"
+{{- end }}
 
   vars.platform = "{{ .Platform }}"
   vars.tenant = "{{ .Tenant }}"
   vars.site = "{{ .Site }}"
+{{- if .HasIPv6 }}
   vars.network6 = "net-{{ .PrintablePrimaryNet6 }}"
+{{- end }}
+{{- if .HasIPv4 }}
   vars.network = "net-{{ .PrintablePrimaryNet4 }}"
+{{- end }}
 
   vars.http_vhosts["{{ .Name }}"] = {
     http_vhost  = "{{ .Name }}"
@@ -147,8 +155,8 @@ type icinga2Params struct {
 	Sites        []string
 }
 
-func (g *Generator) Icinga2Config() error {
-	gateways, err := g.client.ListGateways()
+func (g *Generator) Icinga2Config(ctx context.Context) error {
+	gateways, err := g.client.ListGateways(ctx)
 	if err != nil {
 		return fmt.Errorf("ListGateways: %v", err)
 	}
@@ -163,14 +171,14 @@ func (g *Generator) Icinga2Config() error {
 		}
 	}
 
-	tenants, err := g.client.ListTenants()
+	tenants, err := g.client.ListTenants(ctx)
 	if err != nil {
 		return fmt.Errorf("ListTenants: %v", err)
 	}
 
-	devices, err := g.client.GetHostList()
+	devices, err := g.hostList(ctx)
 	if err != nil {
-		return fmt.Errorf("GetHostList: %v", err)
+		return fmt.Errorf("hostList: %v", err)
 	}
 
 	allPlatforms := []string{}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+// Lint runs the mapping logic of all generators without writing any output,
+// and returns every NetBox object which would be skipped by a generator or
+// would result in broken output
+func (g *Generator) Lint(ctx context.Context) ([]common.Warning, error) {
+	_, err := g.client.GetHostList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetHostList: %v", err)
+	}
+
+	_, err = g.client.ListGateways(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListGateways: %v", err)
+	}
+
+	_, err = g.client.ListTenants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListTenants: %v", err)
+	}
+
+	_, err = g.client.GetPrefixList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetPrefixList: %v", err)
+	}
+
+	allIpAddresses, err := g.client.GetIpAddressList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetIpAddressList: %v", err)
+	}
+
+	allConfigContexts, err := g.client.ListConfigContexts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListConfigContexts: %v", err)
+	}
+
+	allServices, err := g.client.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListServices: %v", err)
+	}
+
+	allHosts, err := g.hostList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("hostList: %v", err)
+	}
+
+	// The dns generators skip prefixes which are too large for a reverse
+	// zone, and records which cannot be derived from their objects
+	_, err = g.reverseZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reverseZones: %v", err)
+	}
+
+	_, recordWarnings := derivedRecords(allIpAddresses, allServices, allHosts, "")
+	g.client.AddWarnings(recordWarnings...)
+
+	warnings := g.client.Warnings()
+
+	allZones := []Zone{}
+	for _, context := range allConfigContexts {
+		zones, err := parseDnsZones([]common.ConfigContext{context})
+		if err != nil {
+			warnings = append(warnings, common.Warning{
+				Object:  netboxclient.ObjectConfigContext,
+				ID:      context.ID,
+				Name:    context.Name,
+				Message: err.Error(),
+			})
+			continue
+		}
+		allZones = append(allZones, zones...)
+	}
+
+	// Addresses without a dns name are reported by reverseZones
+	for _, ip := range allIpAddresses {
+		if ip.Dns == "" {
+			continue
+		}
+
+		// The same check as in forwardZones, so lint reports exactly
+		// the addresses which are dropped from the forward zones
+		inZone := false
+		for _, zone := range allZones {
+			if _, ok := relativeName(ip.Dns, zone.Name); ok {
+				inZone = true
+				break
+			}
+		}
+
+		if !inZone {
+			warnings = append(warnings, common.Warning{
+				Object:  netboxclient.ObjectIpAddress,
+				ID:      ip.ID,
+				Name:    ip.Address.String(),
+				Message: fmt.Sprintf("dns name %s does not match any forward zone", ip.Dns),
+			})
+		}
+	}
+
+	sortWarnings(warnings)
+
+	return warnings, nil
+}
+
+// sortWarnings sorts warnings by object type and id
+func sortWarnings(warnings []common.Warning) {
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Object != warnings[j].Object {
+			return warnings[i].Object < warnings[j].Object
+		}
+		return warnings[i].ID < warnings[j].ID
+	})
+}
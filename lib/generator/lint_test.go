@@ -0,0 +1,53 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	g, server := newTestGenerator(t)
+
+	// A service with a name which cannot be used in a SRV record
+	services := append(server.Objects("/ipam/services/"), json.RawMessage(`{
+		"id": 99,
+		"device": {"id": 1, "name": "server01.as65342.net"},
+		"name": "web_admin",
+		"port": 8443,
+		"protocol": {"value": 6, "label": "TCP"},
+		"ipaddresses": []
+	}`))
+	server.SetObjects("/ipam/services/", services)
+
+	// An address which ends with the name of a zone, without being in it
+	ipAddresses := append(server.Objects("/ipam/ip-addresses/"), json.RawMessage(`{
+		"id": 98,
+		"address": "192.0.2.98/24",
+		"status": {"value": "1", "label": "Active"},
+		"dns_name": "badexample.org"
+	}`))
+	server.SetObjects("/ipam/ip-addresses/", ipAddresses)
+
+	warnings, err := g.Lint(context.Background())
+	if err != nil {
+		t.Fatalf("Lint: %v", err)
+	}
+
+	expected := map[string]string{
+		"pdu01.as65342.net": "has no tenant",
+		"vm03.as65342.net":  "has no primary address",
+		"198.51.100.5":      "dns name www.example.com does not match any forward zone",
+		"web_admin":         "service name cannot be used in a SRV record",
+		"192.0.2.30":        "has no dns name, it gets no PTR record",
+		"192.0.2.98":        "dns name badexample.org does not match any forward zone",
+	}
+	for _, warning := range warnings {
+		if expected[warning.Name] == warning.Message {
+			delete(expected, warning.Name)
+		}
+	}
+	for name, message := range expected {
+		t.Errorf("missing warning for %s: %s", name, message)
+	}
+}
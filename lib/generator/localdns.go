@@ -0,0 +1,262 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+const (
+	LocalUnbound = "unbound"
+	LocalDnsmasq = "dnsmasq"
+)
+
+// localDnsFiles contains the name of the file written for every format of
+// LocalDNS
+var localDnsFiles = map[string]string{
+	LocalUnbound: "unbound.local.conf",
+	LocalDnsmasq: "dnsmasq.local.conf",
+}
+
+// localZone contains the records of a zone, with fully qualified names
+type localZone struct {
+	name    string
+	reverse bool
+	rrs     []dns.RR
+}
+
+// ValidateLocalDnsFormats returns an error if any of the formats is unknown
+func ValidateLocalDnsFormats(formats []string) error {
+	for _, format := range formats {
+		if _, ok := localDnsFiles[format]; !ok {
+			return fmt.Errorf("unknown format: %s", format)
+		}
+	}
+	return nil
+}
+
+// localZones returns the records of the reverse and forward zones, as they
+// are written to the zone files
+func (g Generator) localZones(ctx context.Context) ([]localZone, error) {
+	reverseZones, err := g.reverseZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reverseZones: %v", err)
+	}
+
+	forwardZones, err := g.forwardZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("forwardZones: %v", err)
+	}
+
+	reverseTemplate, forwardTemplate, err := zoneTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("zoneTemplates: %v", err)
+	}
+
+	zones := []localZone{}
+	for _, zone := range reverseZones {
+		_, rrs, err := zoneRecords(reverseTemplate, zone)
+		if err != nil {
+			return nil, fmt.Errorf("zoneRecords %s: %v", zone.Name, err)
+		}
+		zones = append(zones, localZone{name: dns.Fqdn(zone.Name), reverse: true, rrs: rrs})
+	}
+	for _, zone := range forwardZones {
+		_, rrs, err := zoneRecords(forwardTemplate, zone)
+		if err != nil {
+			return nil, fmt.Errorf("zoneRecords %s: %v", zone.Name, err)
+		}
+		zones = append(zones, localZone{name: dns.Fqdn(zone.Name), rrs: rrs})
+	}
+
+	return zones, nil
+}
+
+// localRecord returns false for records which cannot be served by a
+// resolver: delegations, wildcards and the CNAMEs of classless reverse
+// zones, which are replaced by the PTR records of the addresses
+func localRecord(zone localZone, rr dns.RR) bool {
+	switch {
+	case rr.Header().Rrtype == dns.TypeNS:
+		return false
+	case strings.HasPrefix(rr.Header().Name, "*."):
+		return false
+	case zone.reverse && rr.Header().Rrtype == dns.TypeCNAME:
+		return false
+	}
+	return true
+}
+
+// rrText returns rr in presentation format, using spaces between fields
+func rrText(rr dns.RR) string {
+	return strings.Join(strings.Fields(rr.String()), " ")
+}
+
+// unboundConfig returns the local-zone, local-data and local-data-ptr
+// statements for unbound serving zones. Every zone is a static local zone,
+// so names which are not in NetBox do not resolve.
+func unboundConfig(zones []localZone) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("# Generated by as65342-netbox, do not edit\nserver:\n")
+
+	for _, zone := range zones {
+		// Classless reverse zones are part of their parent zone
+		if !strings.Contains(strings.SplitN(zone.name, ".", 2)[0], "-") {
+			fmt.Fprintf(buf, "\tlocal-zone: \"%s\" static\n", zone.name)
+		}
+
+		for _, rr := range zone.rrs {
+			if !localRecord(zone, rr) {
+				continue
+			}
+
+			if ptr, ok := rr.(*dns.PTR); ok {
+				if ip, ok := common.PtrAddress(ptr.Hdr.Name); ok {
+					fmt.Fprintf(buf, "\tlocal-data-ptr: \"%s %d %s\"\n", ip, ptr.Hdr.Ttl, ptr.Ptr)
+					continue
+				}
+			}
+
+			// Records containing quotes, like TXT and CAA, are
+			// enclosed in single quotes
+			if text := rrText(rr); strings.Contains(text, "\"") {
+				fmt.Fprintf(buf, "\tlocal-data: '%s'\n", text)
+			} else {
+				fmt.Fprintf(buf, "\tlocal-data: \"%s\"\n", text)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// dnsmasqConfig returns the dnsmasq options serving zones. Addresses are
+// served using host-record, which also answers the PTR queries for the
+// address, the PTR records which differ get a ptr-record. CNAME, MX, SRV
+// and TXT records are supported, other records are skipped.
+func dnsmasqConfig(zones []localZone) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("# Generated by as65342-netbox, do not edit\n")
+
+	// host-record answers PTR queries with the first name of an address
+	hostNames := make(map[string]string)
+	for _, zone := range zones {
+		for _, rr := range zone.rrs {
+			var ip string
+			switch v := rr.(type) {
+			case *dns.A:
+				ip = v.A.String()
+			case *dns.AAAA:
+				ip = v.AAAA.String()
+			default:
+				continue
+			}
+			if _, ok := hostNames[ip]; !ok {
+				hostNames[ip] = strings.ToLower(rr.Header().Name)
+			}
+		}
+	}
+
+	for _, zone := range zones {
+		for _, rr := range zone.rrs {
+			if !localRecord(zone, rr) {
+				continue
+			}
+
+			name := strings.TrimSuffix(rr.Header().Name, ".")
+			switch v := rr.(type) {
+			case *dns.A:
+				fmt.Fprintf(buf, "host-record=%s,%s,%d\n", name, v.A, v.Hdr.Ttl)
+			case *dns.AAAA:
+				fmt.Fprintf(buf, "host-record=%s,%s,%d\n", name, v.AAAA, v.Hdr.Ttl)
+			case *dns.PTR:
+				ip, ok := common.PtrAddress(v.Hdr.Name)
+				if ok && strings.EqualFold(hostNames[ip.String()], v.Ptr) {
+					continue
+				}
+				fmt.Fprintf(buf, "ptr-record=%s,%s\n", name, strings.TrimSuffix(v.Ptr, "."))
+			case *dns.CNAME:
+				fmt.Fprintf(buf, "cname=%s,%s\n", name, strings.TrimSuffix(v.Target, "."))
+			case *dns.MX:
+				fmt.Fprintf(buf, "mx-host=%s,%s,%d\n", name, strings.TrimSuffix(v.Mx, "."), v.Preference)
+			case *dns.SRV:
+				fmt.Fprintf(buf, "srv-host=%s,%s,%d,%d,%d\n", name, strings.TrimSuffix(v.Target, "."), v.Port, v.Priority, v.Weight)
+			case *dns.TXT:
+				values := []string{}
+				for _, txt := range v.Txt {
+					values = append(values, "\""+txt+"\"")
+				}
+				fmt.Fprintf(buf, "txt-record=%s,%s\n", name, strings.Join(values, ","))
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// writeOutput writes data to fname below the output directory
+func (g Generator) writeOutput(fname string, data []byte) error {
+	fname = g.out + "/" + fname
+
+	err := ioutil.WriteFile(fname+".new", data, 0644)
+	if err != nil {
+		return fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+
+	err = os.Rename(fname+".new", fname)
+	if err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+	fmt.Printf("[+] Wrote %s\n", fname)
+
+	return nil
+}
+
+// LocalDNS writes the records of the forward and reverse zones as local
+// data for resolvers, which lets small sites resolve internal names without
+// an authoritative nameserver. It writes unbound.local.conf, which can be
+// included in unbound.conf, and dnsmasq.local.conf, which can be used as a
+// dnsmasq conf-file, depending on formats. With views, these are written for
+// every view.
+func (g Generator) LocalDNS(ctx context.Context, formats []string) error {
+	err := ValidateLocalDnsFormats(formats)
+	if err != nil {
+		return fmt.Errorf("ValidateLocalDnsFormats: %v", err)
+	}
+
+	for _, vg := range g.viewGenerators() {
+		zones, err := vg.localZones(ctx)
+		if err != nil {
+			return fmt.Errorf("localZones: %v", err)
+		}
+
+		err = common.CreateDirIfNotExists(vg.out)
+		if err != nil {
+			return fmt.Errorf("CreateDirIfNotExists: %v", err)
+		}
+
+		for _, format := range formats {
+			var data []byte
+			switch format {
+			case LocalUnbound:
+				data = unboundConfig(zones)
+			case LocalDnsmasq:
+				data = dnsmasqConfig(zones)
+			}
+
+			err = vg.writeOutput(localDnsFiles[format], data)
+			if err != nil {
+				return fmt.Errorf("writeOutput: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,431 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+const (
+	NameserverBind = "bind"
+	NameserverNsd  = "nsd"
+	NameserverKnot = "knot"
+)
+
+const bindPrimaryTemplate = `# Generated by as65342-netbox, do not edit
+{{- range .Zones }}
+
+zone "{{ .Name }}" {
+	type primary;
+	file "{{ $.ZoneDir }}/{{ .File }}";
+{{- if or $.AllowTransfer $.TsigKey }}
+	allow-transfer {
+{{- range $.AllowTransfer }} {{ .Host }};{{ end }}
+{{- if $.TsigKey }} key "{{ $.TsigKey }}";{{ end }} };
+{{- else }}
+	allow-transfer { none; };
+{{- end }}
+{{- if $.AlsoNotify }}
+	notify explicit;
+	also-notify {
+{{- range $.AlsoNotify }} {{ .Host }}{{ if .Port }} port {{ .Port }}{{ end }}{{ if $.TsigKey }} key "{{ $.TsigKey }}"{{ end }};{{ end }} };
+{{- else }}
+	notify no;
+{{- end }}
+};
+{{- end }}
+`
+
+const bindSecondaryTemplate = `# Generated by as65342-netbox, do not edit
+{{- range .Zones }}
+
+zone "{{ .Name }}" {
+	type secondary;
+	file "{{ $.ZoneDir }}/db.{{ .Name }}";
+	primaries {
+{{- range $.Primaries }} {{ .Host }}{{ if .Port }} port {{ .Port }}{{ end }}{{ if $.TsigKey }} key "{{ $.TsigKey }}"{{ end }};{{ end }} };
+	allow-notify {
+{{- range $.Primaries }} {{ .Host }};{{ end }} };
+};
+{{- end }}
+`
+
+const nsdPrimaryTemplate = `# Generated by as65342-netbox, do not edit
+{{- range .Zones }}
+
+zone:
+	name: "{{ .Name }}"
+	zonefile: "{{ $.ZoneDir }}/{{ .File }}"
+{{- range $.AllowTransfer }}
+	provide-xfr: {{ .Host }} {{ or $.TsigKey "NOKEY" }}
+{{- end }}
+{{- range $.AlsoNotify }}
+	notify: {{ .Host }}{{ if .Port }}@{{ .Port }}{{ end }} {{ or $.TsigKey "NOKEY" }}
+{{- end }}
+{{- end }}
+`
+
+const nsdSecondaryTemplate = `# Generated by as65342-netbox, do not edit
+{{- range .Zones }}
+
+zone:
+	name: "{{ .Name }}"
+	zonefile: "{{ $.ZoneDir }}/db.{{ .Name }}"
+{{- range $.Primaries }}
+	allow-notify: {{ .Host }} {{ or $.TsigKey "NOKEY" }}
+	request-xfr: {{ .Host }}{{ if .Port }}@{{ .Port }}{{ end }} {{ or $.TsigKey "NOKEY" }}
+{{- end }}
+{{- end }}
+`
+
+const knotPrimaryTemplate = `# Generated by as65342-netbox, do not edit
+{{- if .AlsoNotify }}
+remote:
+{{- range $idx, $remote := .AlsoNotify }}
+  - id: netbox-notify-{{ $idx }}
+    address: {{ .Host }}{{ if .Port }}@{{ .Port }}{{ end }}
+{{- if $.TsigKey }}
+    key: {{ $.TsigKey }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if or .AllowTransfer .TsigKey }}
+
+acl:
+{{- if .AllowTransfer }}
+  - id: netbox-transfer
+    address: [{{ range $idx, $address := .AllowTransfer }}{{ if $idx }}, {{ end }}{{ .Host }}{{ end }}]
+    action: transfer
+{{- end }}
+{{- if .TsigKey }}
+  - id: netbox-transfer-key
+    key: {{ .TsigKey }}
+    action: transfer
+{{- end }}
+{{- end }}
+
+zone:
+{{- range .Zones }}
+  - domain: {{ .Name }}
+    file: {{ $.ZoneDir }}/{{ .File }}
+{{- if $.AlsoNotify }}
+    notify: [{{ range $idx, $remote := $.AlsoNotify }}{{ if $idx }}, {{ end }}netbox-notify-{{ $idx }}{{ end }}]
+{{- end }}
+{{- if or $.AllowTransfer $.TsigKey }}
+    acl: [{{ if $.AllowTransfer }}netbox-transfer{{ end }}{{ if and $.AllowTransfer $.TsigKey }}, {{ end }}{{ if $.TsigKey }}netbox-transfer-key{{ end }}]
+{{- end }}
+{{- end }}
+`
+
+const knotSecondaryTemplate = `# Generated by as65342-netbox, do not edit
+remote:
+{{- range $idx, $remote := .Primaries }}
+  - id: netbox-primary-{{ $idx }}
+    address: {{ .Host }}{{ if .Port }}@{{ .Port }}{{ end }}
+{{- if $.TsigKey }}
+    key: {{ $.TsigKey }}
+{{- end }}
+{{- end }}
+
+acl:
+  - id: netbox-notify
+    address: [{{ range $idx, $remote := .Primaries }}{{ if $idx }}, {{ end }}{{ .Host }}{{ end }}]
+{{- if .TsigKey }}
+    key: {{ .TsigKey }}
+{{- end }}
+    action: notify
+
+zone:
+{{- range .Zones }}
+  - domain: {{ .Name }}
+    file: {{ $.ZoneDir }}/db.{{ .Name }}
+    master: [{{ range $idx, $remote := $.Primaries }}{{ if $idx }}, {{ end }}netbox-primary-{{ $idx }}{{ end }}]
+    acl: [netbox-notify]
+{{- end }}
+`
+
+// bindViewsTemplate defines a view for every generated view, which
+// includes the zone configuration written for the view
+const bindViewsTemplate = `# Generated by as65342-netbox, do not edit
+{{- range .Views }}
+
+view "{{ .Name }}" {
+	match-clients {
+{{- range .MatchClients }} {{ . }};{{ else }} any;{{ end }} };
+	include "{{ $.ZoneDir }}/{{ .Name }}/{{ $.Include }}";
+};
+{{- end }}
+`
+
+// nameserverTemplates contains the templates for the primary and secondary
+// configuration of every nameserver, indexed by the name of the nameserver
+var nameserverTemplates = map[string]struct {
+	fname              string
+	primary, secondary string
+}{
+	NameserverBind: {"named", bindPrimaryTemplate, bindSecondaryTemplate},
+	NameserverNsd:  {"nsd", nsdPrimaryTemplate, nsdSecondaryTemplate},
+	NameserverKnot: {"knot", knotPrimaryTemplate, knotSecondaryTemplate},
+}
+
+// NameserverConfig describes how the generated zones are served, and is
+// used to write the zone configuration of the nameservers
+type NameserverConfig struct {
+	// Formats contains the nameservers to write configuration for
+	Formats []string
+	// ZoneDir is the directory containing the zone files on the
+	// nameservers
+	ZoneDir string
+	// Primaries contains the addresses from which the secondaries
+	// transfer the zones
+	Primaries []string
+	// AllowTransfer contains the addresses and prefixes allowed to
+	// transfer the zones from the primary
+	AllowTransfer []string
+	// AlsoNotify contains the addresses notified by the primary
+	AlsoNotify []string
+	// TsigKey is the name of the key, defined elsewhere in the
+	// configuration of the nameservers, used for transfers and notifies
+	TsigKey string
+}
+
+// nsAddress is an address or prefix with an optional port, as used in the
+// configuration of nameservers
+type nsAddress struct {
+	Host string
+	Port string
+}
+
+// nameserverZone is a zone served by the nameservers, File is the name of
+// the zone file served by the primary
+type nameserverZone struct {
+	Name string
+	File string
+}
+
+type viewsParams struct {
+	Views   []View
+	ZoneDir string
+	Include string
+}
+
+type nameserverParams struct {
+	Zones         []nameserverZone
+	ZoneDir       string
+	Primaries     []nsAddress
+	AllowTransfer []nsAddress
+	AlsoNotify    []nsAddress
+	TsigKey       string
+}
+
+// parseNsAddresses parses addresses of the form address, address:port,
+// [address]:port or, if prefixes is set, address/length
+func parseNsAddresses(values []string, prefixes bool) ([]nsAddress, error) {
+	addresses := []nsAddress{}
+	for _, value := range values {
+		if strings.Contains(value, "/") {
+			if !prefixes {
+				return nil, fmt.Errorf("%s: prefixes are not allowed", value)
+			}
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+			}
+			addresses = append(addresses, nsAddress{Host: value})
+			continue
+		}
+
+		address := nsAddress{Host: value}
+		if host, port, err := net.SplitHostPort(value); err == nil {
+			address = nsAddress{Host: host, Port: port}
+		}
+		if net.ParseIP(address.Host) == nil {
+			return nil, fmt.Errorf("%s: invalid address", value)
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
+}
+
+// Validate returns an error if a format is unknown, or if any of the
+// addresses is invalid
+func (c NameserverConfig) Validate() error {
+	_, err := c.params(nil)
+	return err
+}
+
+func (c NameserverConfig) params(zones []nameserverZone) (nameserverParams, error) {
+	p := nameserverParams{
+		Zones:   zones,
+		ZoneDir: strings.TrimSuffix(c.ZoneDir, "/"),
+		TsigKey: c.TsigKey,
+	}
+
+	for _, format := range c.Formats {
+		if _, ok := nameserverTemplates[format]; !ok {
+			return p, fmt.Errorf("unknown nameserver: %s", format)
+		}
+	}
+
+	var err error
+	p.Primaries, err = parseNsAddresses(c.Primaries, false)
+	if err != nil {
+		return p, fmt.Errorf("primaries: %v", err)
+	}
+
+	p.AllowTransfer, err = parseNsAddresses(c.AllowTransfer, true)
+	if err != nil {
+		return p, fmt.Errorf("allow_transfer: %v", err)
+	}
+
+	p.AlsoNotify, err = parseNsAddresses(c.AlsoNotify, false)
+	if err != nil {
+		return p, fmt.Errorf("also_notify: %v", err)
+	}
+
+	return p, nil
+}
+
+// writeConfig renders t using p into fname below the output directory
+func (g Generator) writeConfig(fname, t string, p interface{}) error {
+	tmpl, err := template.New(fname).Parse(t)
+	if err != nil {
+		return fmt.Errorf("template.New: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, p)
+	if err != nil {
+		return fmt.Errorf("t.Execute: %v", err)
+	}
+
+	err = g.writeOutput(fname, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("writeOutput: %v", err)
+	}
+
+	return nil
+}
+
+// NameserverConfig writes <nameserver>.primary.conf and
+// <nameserver>.secondary.conf for every configured nameserver, which
+// configure every forward and reverse zone, and can be included in the
+// configuration of the nameserver. With views, these are written for every
+// view next to its zones, and for bind named.views.primary.conf and
+// named.views.secondary.conf define the views and include them.
+func (g Generator) NameserverConfig(ctx context.Context, cfg NameserverConfig) error {
+	if len(cfg.Formats) == 0 {
+		return nil
+	}
+
+	for _, vg := range g.viewGenerators() {
+		viewCfg := cfg
+		if vg.view != nil && cfg.ZoneDir != "" {
+			viewCfg.ZoneDir = strings.TrimSuffix(cfg.ZoneDir, "/") + "/" + vg.view.Name
+		}
+
+		err := vg.writeNameserverConfig(ctx, viewCfg)
+		if err != nil {
+			return fmt.Errorf("writeNameserverConfig: %v", err)
+		}
+	}
+
+	if len(g.Views) == 0 {
+		return nil
+	}
+
+	p := viewsParams{
+		Views:   g.Views,
+		ZoneDir: strings.TrimSuffix(cfg.ZoneDir, "/"),
+	}
+	if p.ZoneDir == "" {
+		p.ZoneDir = g.out
+	}
+
+	for _, format := range cfg.Formats {
+		if format != NameserverBind {
+			fmt.Fprintf(os.Stderr, "WARNING: %s does not support views, run an instance for every view using <view>/%s.primary.conf\n", format, nameserverTemplates[format].fname)
+			continue
+		}
+
+		p.Include = nameserverTemplates[format].fname + ".primary.conf"
+		err := g.writeConfig("named.views.primary.conf", bindViewsTemplate, p)
+		if err != nil {
+			return fmt.Errorf("writeConfig: %v", err)
+		}
+
+		if len(cfg.Primaries) == 0 {
+			continue
+		}
+
+		p.Include = nameserverTemplates[format].fname + ".secondary.conf"
+		err = g.writeConfig("named.views.secondary.conf", bindViewsTemplate, p)
+		if err != nil {
+			return fmt.Errorf("writeConfig: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeNameserverConfig writes the configuration of every nameserver for
+// the zones of the view of the generator
+func (g Generator) writeNameserverConfig(ctx context.Context, cfg NameserverConfig) error {
+	reverseZones, err := g.reverseZones(ctx)
+	if err != nil {
+		return fmt.Errorf("reverseZones: %v", err)
+	}
+
+	forwardZones, err := g.forwardZones(ctx)
+	if err != nil {
+		return fmt.Errorf("forwardZones: %v", err)
+	}
+
+	zones := []nameserverZone{}
+	for _, zone := range append(reverseZones, forwardZones...) {
+		file := "db." + zone.Name
+		if g.Dnssec.signs(zone.Name) {
+			file += ".signed"
+		}
+		zones = append(zones, nameserverZone{Name: zone.Name, File: file})
+	}
+
+	p, err := cfg.params(zones)
+	if err != nil {
+		return fmt.Errorf("params: %v", err)
+	}
+	if p.ZoneDir == "" {
+		p.ZoneDir = g.out
+	}
+
+	err = common.CreateDirIfNotExists(g.out)
+	if err != nil {
+		return fmt.Errorf("CreateDirIfNotExists: %v", err)
+	}
+
+	for _, format := range cfg.Formats {
+		templates := nameserverTemplates[format]
+
+		err = g.writeConfig(templates.fname+".primary.conf", templates.primary, p)
+		if err != nil {
+			return fmt.Errorf("writeConfig: %v", err)
+		}
+
+		if len(p.Primaries) == 0 {
+			continue
+		}
+
+		err = g.writeConfig(templates.fname+".secondary.conf", templates.secondary, p)
+		if err != nil {
+			return fmt.Errorf("writeConfig: %v", err)
+		}
+	}
+
+	return nil
+}
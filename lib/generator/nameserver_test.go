@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNameserverConfigValidate(t *testing.T) {
+	if err := testNameserverConfig.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	invalid := []NameserverConfig{
+		{Formats: []string{"powerdns"}},
+		{Primaries: []string{"192.0.2.0/24"}},
+		{AlsoNotify: []string{"ns1.example.org"}},
+		{AllowTransfer: []string{"192.0.2.0/33"}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate: expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestNameserverConfigEscaping(t *testing.T) {
+	g := Generator{out: t.TempDir()}
+
+	cfg := NameserverConfig{ZoneDir: "/srv/dns&zones/", TsigKey: "netbox+xfr's"}
+	p, err := cfg.params([]nameserverZone{{Name: "as65342.net", File: "db.as65342.net"}})
+	if err != nil {
+		t.Fatalf("params: %v", err)
+	}
+
+	if err := g.writeConfig("named.primary.conf", bindPrimaryTemplate, p); err != nil {
+		t.Fatalf("writeConfig: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(g.out, "named.primary.conf"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+
+	// Values are written as they are configured, without html escaping
+	for _, s := range []string{`file "/srv/dns&zones/db.as65342.net";`, `key "netbox+xfr's";`} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("expected %q in:\n%s", s, data)
+		}
+	}
+}
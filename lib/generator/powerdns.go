@@ -0,0 +1,333 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Changetypes of the rrsets in a PATCH of a zone
+const (
+	pdnsReplace = "REPLACE"
+	pdnsDelete  = "DELETE"
+)
+
+// PowerDNS is a PowerDNS authoritative server which is managed using its
+// HTTP api, instead of writing zone files
+type PowerDNS struct {
+	// URL is the address of the webserver, like http://127.0.0.1:8081
+	URL string
+	// ServerID is the id of the server in the api, usually localhost
+	ServerID string
+	APIKey   string
+	// Kind is the kind of new zones: Native, Master or Slave
+	Kind    string
+	Timeout time.Duration
+}
+
+type pdnsRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type pdnsRRset struct {
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	TTL        uint32       `json:"ttl,omitempty"`
+	ChangeType string       `json:"changetype,omitempty"`
+	Records    []pdnsRecord `json:"records"`
+}
+
+type pdnsZone struct {
+	Name        string      `json:"name"`
+	Kind        string      `json:"kind,omitempty"`
+	Nameservers []string    `json:"nameservers"`
+	SoaEditAPI  string      `json:"soa_edit_api"`
+	RRsets      []pdnsRRset `json:"rrsets"`
+}
+
+// pdnsError is the body of failed api requests
+type pdnsError struct {
+	Error string `json:"error"`
+}
+
+// request sends in as json to path below the server, and decodes the
+// response into out. It returns the status of the response, which is an
+// error for statuses of 300 and higher, except for 404 if allowNotFound
+// is set.
+func (p PowerDNS) request(ctx context.Context, method, path string, in, out interface{}, allowNotFound bool) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return 0, fmt.Errorf("json.Marshal: %v", err)
+		}
+	}
+
+	url := strings.TrimSuffix(p.URL, "/") + "/api/v1/servers/" + p.ServerID + path
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("http.NewRequest: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-API-Key", p.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	c := &http.Client{Timeout: p.Timeout}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("c.Do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("ioutil.ReadAll: %v", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && allowNotFound:
+		return resp.StatusCode, nil
+	case resp.StatusCode >= 300:
+		apiErr := pdnsError{}
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+		return resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, apiErr.Error)
+	}
+
+	if out != nil && len(data) > 0 {
+		err = json.Unmarshal(data, out)
+		if err != nil {
+			return resp.StatusCode, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// rdata returns the content of rr as used by the api
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// rrsetKey returns the name and type of rrset, which identify it in a zone
+func rrsetKey(name, rtype string) string {
+	return strings.ToLower(dns.Fqdn(name)) + " " + rtype
+}
+
+// toRRsets groups rrs into rrsets, in the order in which they first
+// appear. The TTL of an rrset is the lowest TTL of its records.
+func toRRsets(rrs []dns.RR) []pdnsRRset {
+	rrsets := []pdnsRRset{}
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		h := rr.Header()
+		key := rrsetKey(h.Name, dns.TypeToString[h.Rrtype])
+		idx, ok := index[key]
+		if !ok {
+			idx = len(rrsets)
+			index[key] = idx
+			rrsets = append(rrsets, pdnsRRset{
+				Name: strings.ToLower(h.Name),
+				Type: dns.TypeToString[h.Rrtype],
+				TTL:  h.Ttl,
+			})
+		}
+
+		if h.Ttl < rrsets[idx].TTL {
+			rrsets[idx].TTL = h.Ttl
+		}
+		rrsets[idx].Records = append(rrsets[idx].Records, pdnsRecord{Content: rdata(rr)})
+	}
+
+	return rrsets
+}
+
+// sameRRset returns true if current contains the same records as desired,
+// comparing the records in their canonical form since the server may
+// format them differently
+func sameRRset(current, desired pdnsRRset) bool {
+	if current.TTL != desired.TTL || len(current.Records) != len(desired.Records) {
+		return false
+	}
+
+	keys := func(rrset pdnsRRset) ([]string, bool) {
+		result := []string{}
+		for _, record := range rrset.Records {
+			if record.Disabled {
+				return nil, false
+			}
+			rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", dns.Fqdn(rrset.Name), rrset.Type, record.Content))
+			if err != nil || rr == nil {
+				return nil, false
+			}
+			result = append(result, recordKey(rr))
+		}
+		sort.Strings(result)
+		return result, true
+	}
+
+	currentKeys, ok := keys(current)
+	if !ok {
+		return false
+	}
+	desiredKeys, ok := keys(desired)
+	if !ok {
+		return false
+	}
+
+	for idx := range currentKeys {
+		if currentKeys[idx] != desiredKeys[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updateZone creates zone on the server, or replaces and deletes the rrsets
+// which differ from the records rendered by t in a single PATCH. The serial
+// is increased whenever anything changes.
+func (p PowerDNS) updateZone(ctx context.Context, t *template.Template, zone Zone, format SerialFormat) error {
+	soa, rrs, err := zoneRecords(t, zone)
+	if err != nil {
+		return fmt.Errorf("zoneRecords: %v", err)
+	}
+
+	name := dns.Fqdn(strings.ToLower(zone.Name))
+	current := pdnsZone{}
+	status, err := p.request(ctx, http.MethodGet, "/zones/"+name, nil, &current, true)
+	if err != nil {
+		return fmt.Errorf("request: %v", err)
+	}
+
+	if status == http.StatusNotFound {
+		soa.Serial = nextSerial(format, 0, timeNow())
+		created := pdnsZone{
+			Name:        name,
+			Kind:        p.Kind,
+			Nameservers: []string{},
+			RRsets:      toRRsets(append([]dns.RR{soa}, rrs...)),
+		}
+
+		_, err = p.request(ctx, http.MethodPost, "/zones", created, nil, false)
+		if err != nil {
+			return fmt.Errorf("request: %v", err)
+		}
+		fmt.Printf("[+] Created %s on %s with serial %d\n", zone.Name, p.URL, soa.Serial)
+
+		return nil
+	}
+
+	existing := make(map[string]pdnsRRset)
+	for _, rrset := range current.RRsets {
+		existing[rrsetKey(rrset.Name, rrset.Type)] = rrset
+	}
+
+	changes := []pdnsRRset{}
+	desired := make(map[string]bool)
+	for _, rrset := range toRRsets(rrs) {
+		key := rrsetKey(rrset.Name, rrset.Type)
+		desired[key] = true
+		if old, ok := existing[key]; !ok || !sameRRset(old, rrset) {
+			rrset.ChangeType = pdnsReplace
+			changes = append(changes, rrset)
+		}
+	}
+
+	for _, rrset := range current.RRsets {
+		key := rrsetKey(rrset.Name, rrset.Type)
+		if desired[key] || serverManagedTypes[dns.StringToType[rrset.Type]] {
+			continue
+		}
+		changes = append(changes, pdnsRRset{
+			Name:       rrset.Name,
+			Type:       rrset.Type,
+			ChangeType: pdnsDelete,
+			Records:    []pdnsRecord{},
+		})
+	}
+
+	// The SOA is compared using the current serial, so only changes to
+	// its other fields are a reason to update
+	var serial uint32
+	currentSOA, ok := existing[rrsetKey(name, "SOA")]
+	if ok && len(currentSOA.Records) == 1 {
+		if rr, err := dns.NewRR(name + " 0 IN SOA " + currentSOA.Records[0].Content); err == nil {
+			serial = rr.(*dns.SOA).Serial
+		}
+	}
+	soa.Serial = serial
+	soaRRset := toRRsets([]dns.RR{soa})[0]
+
+	if len(changes) == 0 && ok && sameRRset(currentSOA, soaRRset) {
+		fmt.Printf("[+] Unchanged %s on %s\n", zone.Name, p.URL)
+		return nil
+	}
+
+	soa.Serial = nextSerial(format, serial, timeNow())
+	soaRRset = toRRsets([]dns.RR{soa})[0]
+	soaRRset.ChangeType = pdnsReplace
+	changes = append(changes, soaRRset)
+
+	patch := struct {
+		RRsets []pdnsRRset `json:"rrsets"`
+	}{changes}
+	_, err = p.request(ctx, http.MethodPatch, "/zones/"+name, patch, nil, false)
+	if err != nil {
+		return fmt.Errorf("request: %v", err)
+	}
+	fmt.Printf("[+] Updated %s on %s: %d rrsets changed, serial %d\n", zone.Name, p.URL, len(changes)-1, soa.Serial)
+
+	return nil
+}
+
+// UpdatePowerDNS pushes the forward and reverse zones to a PowerDNS server
+// using its HTTP api, instead of writing them to zone files. Zones which do
+// not exist yet are created.
+func (g Generator) UpdatePowerDNS(ctx context.Context, p PowerDNS) error {
+	reverseZones, err := g.reverseZones(ctx)
+	if err != nil {
+		return fmt.Errorf("reverseZones: %v", err)
+	}
+
+	forwardZones, err := g.forwardZones(ctx)
+	if err != nil {
+		return fmt.Errorf("forwardZones: %v", err)
+	}
+
+	reverseTemplate, forwardTemplate, err := zoneTemplates()
+	if err != nil {
+		return fmt.Errorf("zoneTemplates: %v", err)
+	}
+
+	for _, zone := range reverseZones {
+		err = p.updateZone(ctx, reverseTemplate, zone, g.SerialFormat)
+		if err != nil {
+			return fmt.Errorf("updateZone %s: %v", zone.Name, err)
+		}
+	}
+
+	for _, zone := range forwardZones {
+		err = p.updateZone(ctx, forwardTemplate, zone, g.SerialFormat)
+		if err != nil {
+			return fmt.Errorf("updateZone %s: %v", zone.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const testPowerDNSKey = "secret"
+
+// powerdnsServer is a minimal stand-in for the PowerDNS api, which keeps
+// zones in memory and records the PATCH requests it receives
+type powerdnsServer struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	zones   map[string]*pdnsZone
+	patches map[string][]pdnsRRset
+}
+
+func newPowerdnsServer(t *testing.T) *powerdnsServer {
+	t.Helper()
+
+	s := &powerdnsServer{
+		zones:   make(map[string]*pdnsZone),
+		patches: make(map[string][]pdnsRRset),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *powerdnsServer) fail(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(pdnsError{Error: message})
+}
+
+func (s *powerdnsServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.Header.Get("X-API-Key") != testPowerDNSKey {
+		s.fail(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	const prefix = "/api/v1/servers/localhost/zones"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.fail(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	switch {
+	case r.Method == http.MethodPost && name == "":
+		zone := &pdnsZone{}
+		if err := json.NewDecoder(r.Body).Decode(zone); err != nil || zone.Kind == "" {
+			s.fail(w, http.StatusUnprocessableEntity, "invalid zone")
+			return
+		}
+		if _, ok := s.zones[zone.Name]; ok {
+			s.fail(w, http.StatusConflict, "Domain already exists")
+			return
+		}
+		s.zones[zone.Name] = zone
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(zone)
+	case r.Method == http.MethodGet:
+		zone, ok := s.zones[name]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "Could not find domain '"+name+"'")
+			return
+		}
+		json.NewEncoder(w).Encode(zone)
+	case r.Method == http.MethodPatch:
+		zone, ok := s.zones[name]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "Could not find domain '"+name+"'")
+			return
+		}
+		patch := pdnsZone{}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			s.fail(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		for _, change := range patch.RRsets {
+			rrsets := []pdnsRRset{}
+			for _, rrset := range zone.RRsets {
+				if rrset.Name != change.Name || rrset.Type != change.Type {
+					rrsets = append(rrsets, rrset)
+				}
+			}
+			if change.ChangeType == pdnsReplace {
+				change.ChangeType = ""
+				rrsets = append(rrsets, change)
+			}
+			zone.RRsets = rrsets
+		}
+		s.patches[name] = append(s.patches[name], patch.RRsets...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.fail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// serial returns the serial of zone on the server
+func (s *powerdnsServer) serial(t *testing.T, name string) uint32 {
+	t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, rrset := range s.zones[name].RRsets {
+		if rrset.Type == "SOA" {
+			rr, err := dns.NewRR(name + " 0 IN SOA " + rrset.Records[0].Content)
+			if err != nil {
+				t.Fatalf("dns.NewRR: %v", err)
+			}
+			return rr.(*dns.SOA).Serial
+		}
+	}
+
+	t.Fatalf("%s: no SOA", name)
+	return 0
+}
+
+func TestUpdatePowerDNS(t *testing.T) {
+	g, _ := newTestGenerator(t)
+
+	now := time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	pdns := newPowerdnsServer(t)
+	p := PowerDNS{
+		URL:      pdns.URL + "/",
+		ServerID: "localhost",
+		APIKey:   testPowerDNSKey,
+		Kind:     "Native",
+		Timeout:  5 * time.Second,
+	}
+
+	ctx := context.Background()
+	if err := g.UpdatePowerDNS(ctx, p); err != nil {
+		t.Fatalf("UpdatePowerDNS: %v", err)
+	}
+
+	// Every zone is created with the first serial of the day
+	for _, name := range []string{"as65342.net.", "example.org.", "2.0.192.in-addr.arpa.", "64-26.2.0.192.in-addr.arpa."} {
+		if _, ok := pdns.zones[name]; !ok {
+			t.Fatalf("%s: zone was not created", name)
+		}
+		if serial := pdns.serial(t, name); serial != 2018010200 {
+			t.Errorf("%s: expected serial 2018010200, got %d", name, serial)
+		}
+	}
+
+	// Nothing changed, so nothing is patched
+	if err := g.UpdatePowerDNS(ctx, p); err != nil {
+		t.Fatalf("UpdatePowerDNS: %v", err)
+	}
+	if len(pdns.patches) != 0 {
+		t.Fatalf("expected no patches, got %v", pdns.patches)
+	}
+
+	// Records changed on the server are replaced, unknown rrsets are
+	// deleted, and the serial is increased
+	zone := pdns.zones["as65342.net."]
+	for idx, rrset := range zone.RRsets {
+		if rrset.Name == "gw.as65342.net." && rrset.Type == "A" {
+			zone.RRsets[idx].Records = []pdnsRecord{{Content: "192.0.2.254"}}
+		}
+	}
+	zone.RRsets = append(zone.RRsets,
+		pdnsRRset{Name: "stale.as65342.net.", Type: "A", TTL: 60, Records: []pdnsRecord{{Content: "192.0.2.99"}}},
+		pdnsRRset{Name: "as65342.net.", Type: "DNSKEY", TTL: 60, Records: []pdnsRecord{{Content: "257 3 13 AAAA"}}},
+	)
+
+	if err := g.UpdatePowerDNS(ctx, p); err != nil {
+		t.Fatalf("UpdatePowerDNS: %v", err)
+	}
+
+	changes := []string{}
+	for _, rrset := range pdns.patches["as65342.net."] {
+		changes = append(changes, rrset.ChangeType+" "+rrset.Name+" "+rrset.Type)
+	}
+	expected := []string{
+		"REPLACE gw.as65342.net. A",
+		"DELETE stale.as65342.net. A",
+		"REPLACE as65342.net. SOA",
+	}
+	if strings.Join(changes, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected changes %v, got %v", expected, changes)
+	}
+	if len(pdns.patches) != 1 {
+		t.Errorf("expected only as65342.net to be patched, got %d zones", len(pdns.patches))
+	}
+	if serial := pdns.serial(t, "as65342.net."); serial != 2018010201 {
+		t.Errorf("expected serial 2018010201, got %d", serial)
+	}
+
+	// A server which does not exist is not mistaken for a missing zone
+	wrongServer := p
+	wrongServer.ServerID = "ns1"
+	err := g.UpdatePowerDNS(ctx, wrongServer)
+	if err == nil || !strings.Contains(err.Error(), "POST /zones: 404 Not Found") {
+		t.Errorf("expected the zone creation to fail, got %v", err)
+	}
+
+	// A wrong key is reported with the error of the server
+	p.APIKey = "wrong"
+	err = g.UpdatePowerDNS(ctx, p)
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized: Unauthorized") {
+		t.Errorf("expected an authorization error, got %v", err)
+	}
+}
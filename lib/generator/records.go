@@ -0,0 +1,321 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+// RoleSecondary is the role of addresses which are an alias of the host
+const RoleSecondary = "secondary"
+
+// Keys of the custom fields of addresses, and of the config context of hosts,
+// which contain SSHFP and TLSA records
+const (
+	sshfpKey = "sshfp"
+	tlsaKey  = "tlsa"
+)
+
+// serviceLabel matches the names of services which can be used in the owner
+// name of SRV records
+var serviceLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// tlsaPrefix matches the port and protocol of a TLSA entry, like 443/tcp
+var tlsaPrefix = regexp.MustCompile(`^(\d+)/(tcp|udp|sctp)$`)
+
+// stringList returns the entries in a custom field or config context value,
+// which is either a list of strings or a string with comma or newline
+// separated entries
+func stringList(value interface{}) []string {
+	entries := []string{}
+	switch v := value.(type) {
+	case string:
+		for _, entry := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			entries = append(entries, stringList(item)...)
+		}
+	}
+	return entries
+}
+
+// relativeName returns name relative to zone, and false if name is not part
+// of zone
+func relativeName(name, zone string) (string, bool) {
+	name = strings.TrimSuffix(name, ".")
+	zone = strings.TrimSuffix(zone, ".")
+
+	switch {
+	case strings.EqualFold(name, zone):
+		return "@", true
+	case len(name) > len(zone) && strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(zone)):
+		return name[:len(name)-len(zone)-1], true
+	}
+
+	return "", false
+}
+
+// caaRecords returns the CAA records configured for a zone
+func caaRecords(settings common.ZoneSettings) []Record {
+	records := []Record{}
+	for _, caa := range settings.CAA {
+		records = append(records, Record{
+			Name:  "@",
+			Type:  CAA,
+			Value: fmt.Sprintf("%d %s \"%s\"", caa.Flags, caa.Tag, caa.Value),
+		})
+	}
+	return records
+}
+
+// recordSet collects records with fully qualified names, and drops
+// duplicates and records which would not parse
+type recordSet struct {
+	records  []Record
+	seen     map[string]bool
+	warnings []common.Warning
+}
+
+// warn records a problem with the NetBox object a record is derived from
+func (s *recordSet) warn(object string, id int64, name string, format string, args ...interface{}) {
+	s.warnings = append(s.warnings, common.Warning{
+		Object:  object,
+		ID:      id,
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// add adds r, name is the name of the object r was derived from in warnings
+func (s *recordSet) add(r Record, name string) {
+	key := strings.ToLower(dns.Fqdn(r.Name)) + " " + r.Type + " " + r.Value
+	if s.seen[key] {
+		return
+	}
+
+	// Packing the record catches data which parses, like invalid hex
+	rr, err := dns.NewRR(fmt.Sprintf("%s IN %s %s", dns.Fqdn(r.Name), r.Type, r.Value))
+	if err == nil {
+		_, err = dns.PackRR(rr, make([]byte, dns.MaxMsgSize), 0, nil, false)
+	}
+	if err != nil {
+		s.warn(r.object, r.id, name, "invalid %s record for %s: %v", r.Type, r.Name, err)
+		return
+	}
+
+	s.seen[key] = true
+	s.records = append(s.records, r)
+}
+
+// addEntries adds the SSHFP and TLSA records listed in values to name, which
+// are taken from the object with the given id and name
+func (s *recordSet) addEntries(name string, values map[string]interface{}, object string, id int64, objectName string) {
+	for _, entry := range stringList(values[sshfpKey]) {
+		s.add(Record{Name: name, Type: SSHFP, Value: entry, object: object, id: id}, objectName)
+	}
+
+	for _, entry := range stringList(values[tlsaKey]) {
+		fields := strings.SplitN(entry, " ", 2)
+		match := tlsaPrefix.FindStringSubmatch(fields[0])
+		if match == nil || len(fields) != 2 {
+			s.warn(object, id, objectName, "invalid TLSA entry for %s, expected <port>/<protocol> <data>: %s", name, entry)
+			continue
+		}
+		s.add(Record{
+			Name:   "_" + match[1] + "._" + match[2] + "." + name,
+			Type:   TLSA,
+			Value:  strings.TrimSpace(fields[1]),
+			object: object,
+			id:     id,
+		}, objectName)
+	}
+}
+
+// addressAliases returns the name which holds the data of secondary
+// addresses which are an alias of their host, by the id of the address. A
+// secondary address is an alias if its host has a non-secondary address
+// with the same address and another dns name, and if no other address has
+// the dns name of the secondary address.
+func addressAliases(ipAddresses []common.IpAddress) map[int64]string {
+	// hostAddresses contains the name of the non-secondary addresses of
+	// every host, by host and address
+	hostAddresses := make(map[string]string)
+	for _, ip := range ipAddresses {
+		if ip.Dns == "" || ip.Host == "" || strings.EqualFold(ip.Role, RoleSecondary) {
+			continue
+		}
+		key := ip.Host + " " + ip.Address.String()
+		if _, ok := hostAddresses[key]; !ok {
+			hostAddresses[key] = ip.Dns
+		}
+	}
+
+	candidates := make(map[int64]string)
+	ownAddress := make(map[string]bool)
+	for _, ip := range ipAddresses {
+		if ip.Dns == "" {
+			continue
+		}
+		target, ok := hostAddresses[ip.Host+" "+ip.Address.String()]
+		if ip.Host != "" && ok && strings.EqualFold(ip.Role, RoleSecondary) && !strings.EqualFold(target, ip.Dns) {
+			candidates[ip.ID] = target
+			continue
+		}
+		ownAddress[strings.ToLower(ip.Dns)] = true
+	}
+
+	aliases := make(map[int64]string)
+	for _, ip := range ipAddresses {
+		if target, ok := candidates[ip.ID]; ok && !ownAddress[strings.ToLower(ip.Dns)] {
+			aliases[ip.ID] = target
+		}
+	}
+
+	return aliases
+}
+
+// derivedRecords returns the records which follow from the addresses,
+// services and hosts in NetBox, using fully qualified names:
+//
+//   - A and AAAA records for every address with a dns name, including
+//     secondary addresses
+//   - a CNAME to the name of the host for secondary addresses which share
+//     the address of the host under another name, see addressAliases
+//   - SRV records for every service, pointing to the names of the addresses
+//     of the service, or to the name of the host
+//   - SSHFP and TLSA records from the sshfp and tlsa custom fields of
+//     addresses, and from the sshfp and tlsa keys in the config context of
+//     hosts, with TLSA entries of the form <port>/<protocol> <data>
+//   - a TXT record with the url of the address or service for every address
+//     and SRV record, if baseURL is set
+//
+// Entries which do not result in a valid record are skipped, and returned
+// as warnings.
+func derivedRecords(ipAddresses []common.IpAddress, services []common.Service, hosts []common.ManagedDevice, baseURL string) ([]Record, []common.Warning) {
+	// The name of a host is the first dns name of its addresses which
+	// are not secondary
+	hostNames := make(map[string]string)
+	for _, ip := range ipAddresses {
+		if ip.Dns == "" || ip.Host == "" || strings.EqualFold(ip.Role, RoleSecondary) {
+			continue
+		}
+		if _, ok := hostNames[ip.Host]; !ok {
+			hostNames[ip.Host] = ip.Dns
+		}
+	}
+
+	aliasTargets := addressAliases(ipAddresses)
+	aliases := make(map[string]string)
+	for _, ip := range ipAddresses {
+		if target, ok := aliasTargets[ip.ID]; ok {
+			aliases[strings.ToLower(ip.Dns)] = target
+		}
+	}
+
+	// canonical returns the name which holds the data of name
+	canonical := func(name string) string {
+		if target, ok := aliases[strings.ToLower(name)]; ok {
+			return target
+		}
+		return name
+	}
+
+	s := &recordSet{seen: make(map[string]bool)}
+	addresses := make(map[int64]string)
+	for _, ip := range ipAddresses {
+		if ip.Dns == "" {
+			continue
+		}
+		addresses[ip.ID] = ip.Dns
+		name := ip.Address.String()
+
+		r := Record{
+			Name:   ip.Dns,
+			Value:  ip.Address.String(),
+			object: netboxclient.ObjectIpAddress,
+			id:     ip.ID,
+		}
+		switch {
+		case aliases[strings.ToLower(ip.Dns)] != "":
+			r.Type = CNAME
+			r.Value = common.ToFqdn(aliases[strings.ToLower(ip.Dns)])
+		case ip.Address.To4() == nil:
+			r.Type = "AAAA"
+		default:
+			r.Type = "A"
+		}
+		s.add(r, name)
+
+		s.addEntries(canonical(ip.Dns), ip.CustomFields, netboxclient.ObjectIpAddress, ip.ID, name)
+	}
+
+	// Services are announced in the domain of the host offering them, so
+	// _ssh._tcp.as65342.net points to every host in as65342.net running ssh
+	for _, service := range services {
+		label := strings.ToLower(strings.Replace(strings.TrimSpace(service.Name), " ", "-", -1))
+		if !serviceLabel.MatchString(label) {
+			s.warn(netboxclient.ObjectService, service.ID, service.Name, "service name cannot be used in a SRV record")
+			continue
+		}
+
+		targets := []string{}
+		for _, id := range service.IpAddresses {
+			if name, ok := addresses[id]; ok {
+				targets = append(targets, canonical(name))
+			}
+		}
+		if len(targets) == 0 && hostNames[service.Host] != "" {
+			targets = append(targets, hostNames[service.Host])
+		}
+
+		for _, target := range targets {
+			labels := dns.SplitDomainName(target)
+			if len(labels) < 2 {
+				continue
+			}
+
+			s.add(Record{
+				Name:   "_" + label + "._" + service.Protocol + "." + strings.Join(labels[1:], "."),
+				Type:   SRV,
+				Value:  fmt.Sprintf("0 0 %d %s", service.Port, common.ToFqdn(target)),
+				object: netboxclient.ObjectService,
+				id:     service.ID,
+			}, service.Name)
+		}
+	}
+
+	for _, host := range hosts {
+		config, ok := host.Config.(map[string]interface{})
+		if !ok || hostNames[host.Name] == "" {
+			continue
+		}
+		s.addEntries(hostNames[host.Name], config, host.Object, host.ID, host.Name)
+	}
+
+	if baseURL != "" {
+		for _, r := range s.records {
+			url := netboxclient.WebURL(baseURL, r.object, r.id)
+			if url == "" || (r.Type != "A" && r.Type != "AAAA" && r.Type != SRV) {
+				continue
+			}
+			s.add(Record{
+				Name:   r.Name,
+				Type:   TXT,
+				Value:  "\"netbox=" + url + "\"",
+				object: r.object,
+				id:     r.id,
+			}, r.Name)
+		}
+	}
+
+	return s.records, s.warnings
+}
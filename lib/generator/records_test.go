@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+func TestDerivedRecords(t *testing.T) {
+	ipAddresses := []common.IpAddress{
+		{ID: 1, Address: net.ParseIP("192.0.2.10"), Dns: "host.example.org", Host: "host"},
+		{ID: 2, Address: net.ParseIP("2001:db8::10"), Dns: "host.example.org", Host: "host",
+			CustomFields: map[string]interface{}{"sshfp": []interface{}{"4 2 a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1", "4 2 zz"}}},
+		{ID: 3, Address: net.ParseIP("192.0.2.10"), Dns: "alias.example.org", Host: "host", Role: "Secondary",
+			CustomFields: map[string]interface{}{"tlsa": "443/tcp 3 1 1 0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c\n443 3 1 1 0c0c"}},
+		{ID: 4, Address: net.ParseIP("192.0.2.12"), Dns: "vip.example.org", Host: "other", Role: "Secondary"},
+		{ID: 5, Address: net.ParseIP("192.0.2.13"), Dns: "ftp.example.org", Host: "host", Role: "Secondary"},
+	}
+
+	services := []common.Service{
+		{ID: 10, Name: "https", Protocol: "tcp", Port: 443, Host: "host", IpAddresses: []int64{3}},
+		{ID: 11, Name: "Web admin", Protocol: "tcp", Port: 8443, Host: "host"},
+		{ID: 12, Name: "not_valid", Protocol: "tcp", Port: 1, Host: "host"},
+	}
+
+	hosts := []common.ManagedDevice{
+		{Name: "host", Config: map[string]interface{}{"sshfp": "1 2 3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f"}},
+	}
+
+	records, warnings := derivedRecords(ipAddresses, services, hosts, "https://netbox.example.org")
+
+	// The invalid SSHFP and TLSA entries and the service with an invalid
+	// name are skipped. alias shares the address of host, so it is a CNAME
+	// and its TLSA record is moved to host. vip and ftp have an address of
+	// their own, so they keep their address record.
+	expected := []Record{
+		{Name: "host.example.org", Type: "A", Value: "192.0.2.10"},
+		{Name: "host.example.org", Type: "AAAA", Value: "2001:db8::10"},
+		{Name: "host.example.org", Type: SSHFP, Value: "4 2 a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"},
+		{Name: "alias.example.org", Type: CNAME, Value: "host.example.org."},
+		{Name: "_443._tcp.host.example.org", Type: TLSA, Value: "3 1 1 0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c"},
+		{Name: "vip.example.org", Type: "A", Value: "192.0.2.12"},
+		{Name: "ftp.example.org", Type: "A", Value: "192.0.2.13"},
+		{Name: "_https._tcp.example.org", Type: SRV, Value: "0 0 443 host.example.org."},
+		{Name: "_web-admin._tcp.example.org", Type: SRV, Value: "0 0 8443 host.example.org."},
+		{Name: "host.example.org", Type: SSHFP, Value: "1 2 3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f3f"},
+		{Name: "host.example.org", Type: TXT, Value: "\"netbox=https://netbox.example.org/ipam/ip-addresses/1/\""},
+		{Name: "host.example.org", Type: TXT, Value: "\"netbox=https://netbox.example.org/ipam/ip-addresses/2/\""},
+		{Name: "vip.example.org", Type: TXT, Value: "\"netbox=https://netbox.example.org/ipam/ip-addresses/4/\""},
+		{Name: "ftp.example.org", Type: TXT, Value: "\"netbox=https://netbox.example.org/ipam/ip-addresses/5/\""},
+		{Name: "_https._tcp.example.org", Type: TXT, Value: "\"netbox=https://netbox.example.org/ipam/services/10/\""},
+		{Name: "_web-admin._tcp.example.org", Type: TXT, Value: "\"netbox=https://netbox.example.org/ipam/services/11/\""},
+	}
+
+	if len(records) != len(expected) {
+		for _, r := range records {
+			t.Logf("got: %s %s %s", r.Name, r.Type, r.Value)
+		}
+		t.Fatalf("expected %d records, got %d", len(expected), len(records))
+	}
+
+	for idx, r := range records {
+		if r.Name != expected[idx].Name || r.Type != expected[idx].Type || r.Value != expected[idx].Value {
+			t.Errorf("record %d: expected %s %s %s, got %s %s %s", idx,
+				expected[idx].Name, expected[idx].Type, expected[idx].Value, r.Name, r.Type, r.Value)
+		}
+	}
+
+	expectedWarnings := []string{
+		"ipam.ip-address 2 (2001:db8::10) invalid SSHFP record for host.example.org: ",
+		"ipam.ip-address 3 (192.0.2.10) invalid TLSA entry for host.example.org, expected <port>/<protocol> <data>: 443 3 1 1 0c0c",
+		"ipam.service 12 (not_valid) service name cannot be used in a SRV record",
+	}
+	if len(warnings) != len(expectedWarnings) {
+		t.Fatalf("expected %d warnings, got %v", len(expectedWarnings), warnings)
+	}
+	for idx, w := range warnings {
+		if !strings.HasPrefix(w.String(), expectedWarnings[idx]) {
+			t.Errorf("warning %d: expected %q, got %q", idx, expectedWarnings[idx], w.String())
+		}
+	}
+}
+
+func TestAddressAliases(t *testing.T) {
+	ipAddresses := []common.IpAddress{
+		{ID: 1, Address: net.ParseIP("192.0.2.10"), Dns: "host.example.org", Host: "host"},
+		{ID: 2, Address: net.ParseIP("192.0.2.10"), Dns: "alias.example.org", Host: "host", Role: "Secondary"},
+		{ID: 3, Address: net.ParseIP("192.0.2.10"), Dns: "www.example.org", Host: "host", Role: "Secondary"},
+		{ID: 4, Address: net.ParseIP("192.0.2.11"), Dns: "www.example.org", Host: "host", Role: "Secondary"},
+		{ID: 5, Address: net.ParseIP("192.0.2.10"), Dns: "other.example.org", Host: "other", Role: "Secondary"},
+	}
+
+	// www has an address of its own, and other is on another host
+	aliases := addressAliases(ipAddresses)
+	if len(aliases) != 1 || aliases[2] != "host.example.org" {
+		t.Errorf("expected only alias to be an alias of host, got %v", aliases)
+	}
+}
+
+func TestRelativeName(t *testing.T) {
+	tests := []struct {
+		name, zone, expected string
+		ok                   bool
+	}{
+		{"www.example.org", "example.org", "www", true},
+		{"Example.ORG.", "example.org", "@", true},
+		{"_ssh._tcp.example.org", "example.org.", "_ssh._tcp", true},
+		{"www.notexample.org", "example.org", "", false},
+	}
+
+	for _, test := range tests {
+		name, ok := relativeName(test.name, test.zone)
+		if name != test.expected || ok != test.ok {
+			t.Errorf("relativeName(%q, %q): expected %q %v, got %q %v", test.name, test.zone, test.expected, test.ok, name, ok)
+		}
+	}
+}
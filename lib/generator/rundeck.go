@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -8,10 +9,10 @@ import (
 	"github.com/r3boot/as65342-netbox/lib/common"
 )
 
-func (g Generator) RundeckHosts() error {
-	allHosts, err := g.client.GetHostList()
+func (g Generator) RundeckHosts(ctx context.Context) error {
+	allHosts, err := g.hostList(ctx)
 	if err != nil {
-		return fmt.Errorf("GetHostList: %v", err)
+		return fmt.Errorf("hostList: %v", err)
 	}
 
 	err = common.CreateDirIfNotExists(g.out)
@@ -0,0 +1,177 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+type SerialFormat string
+
+const (
+	// SerialDate uses serials of the form YYYYMMDDnn, allowing for 100
+	// changes per day
+	SerialDate SerialFormat = "date"
+	// SerialUnix uses the number of seconds since the epoch as serial
+	SerialUnix SerialFormat = "unix"
+)
+
+// timeNow is used to compute serials, and is replaced by the tests
+var timeNow = time.Now
+
+var serialPattern = regexp.MustCompile(`(?m)^\s*(\d+)\s*; serial`)
+
+// ParseSerialFormat returns the SerialFormat called name. An empty name
+// returns the default of SerialDate.
+func ParseSerialFormat(name string) (SerialFormat, error) {
+	switch SerialFormat(name) {
+	case "", SerialDate:
+		return SerialDate, nil
+	case SerialUnix:
+		return SerialUnix, nil
+	}
+
+	return "", fmt.Errorf("unknown serial format: %s", name)
+}
+
+// nextSerial returns the serial which follows current. The serial never
+// goes backwards, so a zone which changed more than 100 times on a single
+// day continues with the serials of the next day.
+func nextSerial(format SerialFormat, current uint32, now time.Time) uint32 {
+	next := current + 1
+
+	base := uint32(now.Unix())
+	if format != SerialUnix {
+		base = uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100)
+	}
+
+	if base > next {
+		return base
+	}
+	return next
+}
+
+// readSerial returns the serial of the zone file fname, and false if the
+// file does not exist or does not contain a serial
+func readSerial(fname string) (serial uint32, content []byte, ok bool, err error) {
+	content, err = ioutil.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, false, nil
+		}
+		return 0, nil, false, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	match := serialPattern.FindSubmatch(content)
+	if match == nil {
+		return 0, content, false, nil
+	}
+
+	value, err := strconv.ParseUint(string(match[1]), 10, 32)
+	if err != nil {
+		return 0, content, false, nil
+	}
+
+	return uint32(value), content, true, nil
+}
+
+// writeZone renders zone using t and stores it as db.<zone> below the output
+// directory. If serial is empty, the serial of the existing zone file is
+// reused when the contents of the zone did not change, and increased
+// otherwise. The zone is validated before it replaces the existing file, an
+// invalid zone is left behind as db.<zone>.new for inspection. Zones selected
+// by Dnssec are also signed, see writeSigned.
+func (g Generator) writeZone(t *template.Template, zone Zone, serial string) error {
+	fname := g.out + "/db." + zone.Name
+
+	err := validateRecords(zone)
+	if err != nil {
+		return fmt.Errorf("validateRecords: %v", err)
+	}
+
+	p := dnsZoneParams{
+		Name:     zone.Name,
+		Serial:   serial,
+		Settings: zone.Settings,
+		Records:  zone.Records,
+	}
+
+	var keys []signingKey
+	if g.Dnssec.signs(zone.Name) {
+		keys, err = g.Dnssec.zoneKeys(zone.Name)
+		if err != nil {
+			return fmt.Errorf("zoneKeys: %v", err)
+		}
+	}
+
+	if serial == "" {
+		current, content, ok, err := readSerial(fname)
+		if err != nil {
+			return fmt.Errorf("readSerial: %v", err)
+		}
+
+		if ok {
+			p.Serial = strconv.FormatUint(uint64(current), 10)
+
+			buf := &bytes.Buffer{}
+			err = t.Execute(buf, p)
+			if err != nil {
+				return fmt.Errorf("t.Execute: %v", err)
+			}
+
+			// Signed zones also get a new serial when their
+			// signatures have to be refreshed, or when the
+			// signed zone was not written with the current serial
+			resign := false
+			if keys != nil {
+				resign, err = g.Dnssec.needsSigning(fname+".signed", current, keys, timeNow())
+				if err != nil {
+					return fmt.Errorf("needsSigning: %v", err)
+				}
+			}
+
+			if bytes.Equal(buf.Bytes(), content) && !resign {
+				fmt.Printf("[+] Unchanged %s\n", fname)
+				return nil
+			}
+		}
+
+		p.Serial = strconv.FormatUint(uint64(nextSerial(g.SerialFormat, current, timeNow())), 10)
+	}
+
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, p)
+	if err != nil {
+		return fmt.Errorf("t.Execute: %v", err)
+	}
+
+	err = ioutil.WriteFile(fname+".new", buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+
+	err = validateZone(zone.Name, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s.new is invalid: %v", fname, err)
+	}
+
+	err = os.Rename(fname+".new", fname)
+	if err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+	fmt.Printf("[+] Wrote %s\n", fname)
+
+	if keys != nil {
+		err = g.writeSigned(zone.Name, buf.Bytes(), keys)
+		if err != nil {
+			return fmt.Errorf("writeSigned: %v", err)
+		}
+	}
+
+	return nil
+}
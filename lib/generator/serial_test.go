@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		format   SerialFormat
+		current  uint32
+		expected uint32
+	}{
+		{SerialDate, 0, 2018010200},
+		{SerialDate, 2017123105, 2018010200},
+		{SerialDate, 2018010200, 2018010201},
+		{SerialDate, 2018010299, 2018010300},
+		{SerialUnix, 0, uint32(now.Unix())},
+		{SerialUnix, 2018010200, 2018010201},
+	}
+
+	for _, test := range tests {
+		serial := nextSerial(test.format, test.current, now)
+		if serial != test.expected {
+			t.Errorf("nextSerial(%s, %d): expected %d, got %d", test.format, test.current, test.expected, serial)
+		}
+	}
+}
+
+func TestAutomaticSerial(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	out := g.out
+
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC) }
+
+	fname := filepath.Join(out, "db.as65342.net")
+	readZoneSerial := func() uint32 {
+		t.Helper()
+		if err := g.ForwardDNS(context.Background(), ""); err != nil {
+			t.Fatalf("ForwardDNS: %v", err)
+		}
+		serial, _, ok, err := readSerial(fname)
+		if err != nil || !ok {
+			t.Fatalf("readSerial: %v", err)
+		}
+		return serial
+	}
+
+	if serial := readZoneSerial(); serial != 2018010200 {
+		t.Fatalf("expected the first serial of the day, got %d", serial)
+	}
+
+	if serial := readZoneSerial(); serial != 2018010200 {
+		t.Errorf("expected an unchanged zone to keep its serial, got %d", serial)
+	}
+
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	err = ioutil.WriteFile(fname, append(content, []byte("stale A 192.0.2.99\n")...), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+
+	if serial := readZoneSerial(); serial != 2018010201 {
+		t.Errorf("expected a changed zone to get the next serial, got %d", serial)
+	}
+}
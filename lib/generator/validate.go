@@ -0,0 +1,179 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// recordTarget returns the name a PTR, CNAME, NS, MX or SRV record points
+// to, and false for records of other types
+func recordTarget(r Record) (string, bool) {
+	fields := strings.Fields(r.Value)
+	switch strings.ToUpper(r.Type) {
+	case PTR, CNAME, NS:
+		return strings.Join(fields, " "), true
+	case "MX":
+		if len(fields) != 2 {
+			return "", true
+		}
+		return fields[1], true
+	case SRV:
+		if len(fields) != 4 {
+			return "", true
+		}
+		return fields[3], true
+	}
+
+	return "", false
+}
+
+// validateRecords checks the records of zone before it is rendered, since
+// records with an empty field would silently change meaning in the zone
+// file, eg a record without a name is attached to the previous owner, and a
+// record pointing to the root name is useless
+func validateRecords(zone Zone) error {
+	for idx, r := range zone.Records {
+		desc := fmt.Sprintf("record %d (%s %s %s)", idx, r.Name, r.Type, r.Value)
+		target, hasTarget := recordTarget(r)
+		switch {
+		case strings.TrimSpace(r.Name) == "":
+			return fmt.Errorf("%s has no name", desc)
+		case strings.TrimSpace(r.Type) == "":
+			return fmt.Errorf("%s has no type", desc)
+		case strings.TrimSpace(r.Value) == "":
+			return fmt.Errorf("%s has no value", desc)
+		case strings.ContainsAny(r.Name, " \t\n;"):
+			return fmt.Errorf("%s has an invalid name", desc)
+		case hasTarget && (target == "" || target == "."):
+			return fmt.Errorf("%s has no target", desc)
+		}
+	}
+
+	return nil
+}
+
+// validateZone parses the zone file in data, and checks that it would be
+// accepted by a nameserver serving origin. It returns an error describing
+// every problem found.
+func validateZone(origin string, data []byte) error {
+	origin = dns.Fqdn(strings.ToLower(origin))
+
+	rrs := []dns.RR{}
+	zp := dns.NewZoneParser(bytes.NewReader(data), "", "db."+strings.TrimSuffix(origin, "."))
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return fmt.Errorf("syntax error: %v", err)
+	}
+
+	problems := []string{}
+	owners := make(map[string][]dns.RR)
+	names := []string{}
+	soas := 0
+	for _, rr := range rrs {
+		owner := strings.ToLower(rr.Header().Name)
+
+		if !dns.IsSubDomain(origin, owner) {
+			problems = append(problems, fmt.Sprintf("%s %s: out of zone data", owner, dns.TypeToString[rr.Header().Rrtype]))
+			continue
+		}
+
+		if rr.Header().Rrtype == dns.TypeSOA {
+			soas++
+			if owner != origin {
+				problems = append(problems, fmt.Sprintf("%s: SOA record is not at the apex", owner))
+			}
+		}
+
+		for _, other := range owners[owner] {
+			if dns.IsDuplicate(rr, other) {
+				problems = append(problems, fmt.Sprintf("duplicate record: %s", rr))
+			}
+		}
+
+		if _, ok := owners[owner]; !ok {
+			names = append(names, owner)
+		}
+		owners[owner] = append(owners[owner], rr)
+	}
+
+	if soas != 1 {
+		problems = append(problems, fmt.Sprintf("%s: expected 1 SOA record, found %d", origin, soas))
+	}
+
+	for _, owner := range names {
+		cnames := 0
+		other := []string{}
+		for _, rr := range owners[owner] {
+			switch rr.Header().Rrtype {
+			case dns.TypeCNAME:
+				cnames++
+			case dns.TypeRRSIG, dns.TypeNSEC:
+			default:
+				other = append(other, dns.TypeToString[rr.Header().Rrtype])
+			}
+		}
+
+		if cnames > 1 {
+			problems = append(problems, fmt.Sprintf("%s: multiple CNAME records", owner))
+		}
+		if cnames > 0 && len(other) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: CNAME and other data (%s)", owner, strings.Join(other, ", ")))
+		}
+	}
+
+	for _, rr := range rrs {
+		target := ""
+		switch v := rr.(type) {
+		case *dns.PTR:
+			target = v.Ptr
+		case *dns.CNAME:
+			target = v.Target
+		case *dns.SRV:
+			target = v.Target
+		case *dns.NS:
+			target = v.Ns
+		case *dns.MX:
+			target = v.Mx
+		default:
+			continue
+		}
+		target = strings.ToLower(target)
+
+		if target == "." {
+			problems = append(problems, fmt.Sprintf("%s %s: target is the root name", rr.Header().Name, dns.TypeToString[rr.Header().Rrtype]))
+			continue
+		}
+
+		if rr.Header().Rrtype != dns.TypeNS && rr.Header().Rrtype != dns.TypeMX {
+			continue
+		}
+
+		if !dns.IsSubDomain(origin, target) {
+			continue
+		}
+
+		hasAddress := false
+		for _, trr := range owners[target] {
+			switch trr.Header().Rrtype {
+			case dns.TypeA, dns.TypeAAAA:
+				hasAddress = true
+			case dns.TypeCNAME:
+				problems = append(problems, fmt.Sprintf("%s %s: target %s is an alias", rr.Header().Name, dns.TypeToString[rr.Header().Rrtype], target))
+			}
+		}
+		if !hasAddress {
+			problems = append(problems, fmt.Sprintf("%s %s: target %s has no address records", rr.Header().Name, dns.TypeToString[rr.Header().Rrtype], target))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+const validateHeader = `$ORIGIN .
+$TTL 60
+example.org IN SOA ns.example.org. hostmaster.example.org. 1 3600 7200 2419200 60
+                NS ns.example.org.
+                MX 10 mail.example.org.
+$ORIGIN example.org.
+ns A 192.0.2.53
+mail A 192.0.2.25
+`
+
+func TestValidateZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		records string
+		problem string
+	}{
+		{"valid", "www CNAME ns\nsub NS ns.example.net.\n", ""},
+		{"syntax", "www A 192.0.2.300\n", "syntax error"},
+		{"cname and other data", "www CNAME ns\nwww A 192.0.2.80\n", "www.example.org.: CNAME and other data (A)"},
+		{"multiple cnames", "www CNAME ns\nwww CNAME mail\n", "www.example.org.: multiple CNAME records"},
+		{"out of zone", "www.example.net. A 192.0.2.80\n", "www.example.net. A: out of zone data"},
+		{"duplicate", "www A 192.0.2.80\nwww 300 A 192.0.2.80\n", "duplicate record"},
+		{"dangling ns", "sub NS ns.sub.example.org.\n", "target ns.sub.example.org. has no address records"},
+		{"aliased mx", "mx CNAME mail\n@ MX 20 mx\n", "target mx.example.org. is an alias"},
+		{"root ptr", "10 PTR .\n", "10.example.org. PTR: target is the root name"},
+		{"root cname", "www CNAME .\n", "www.example.org. CNAME: target is the root name"},
+		{"root srv", "_http._tcp SRV 0 0 80 .\n", "_http._tcp.example.org. SRV: target is the root name"},
+	}
+
+	for _, test := range tests {
+		err := validateZone("example.org", []byte(validateHeader+test.records))
+		if test.problem == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.problem) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.problem, err)
+		}
+	}
+}
+
+func TestValidateRecords(t *testing.T) {
+	zone := Zone{
+		Name: "example.org",
+		Records: []Record{
+			{Name: "www", Type: "A", Value: "192.0.2.80"},
+			{Name: "", Type: "A", Value: "192.0.2.81"},
+		},
+	}
+
+	err := validateRecords(zone)
+	if err == nil || !strings.Contains(err.Error(), "record 1 ( A 192.0.2.81) has no name") {
+		t.Errorf("validateRecords: expected an error for the record without name, got %v", err)
+	}
+
+	tests := []Record{
+		{Name: "30", Type: PTR, Value: "."},
+		{Name: "www", Type: CNAME, Value: "."},
+		{Name: "sub", Type: NS, Value: "."},
+		{Name: "@", Type: "MX", Value: "10 ."},
+		{Name: "@", Type: "MX", Value: "10"},
+		{Name: "_http._tcp", Type: SRV, Value: "0 0 80 ."},
+	}
+	for _, r := range tests {
+		err := validateRecords(Zone{Name: "example.org", Records: []Record{r}})
+		if err == nil || !strings.Contains(err.Error(), "has no target") {
+			t.Errorf("validateRecords %s %s %s: expected an error for the missing target, got %v", r.Name, r.Type, r.Value, err)
+		}
+	}
+}
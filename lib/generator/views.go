@@ -0,0 +1,188 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+// VrfGlobal is the name used to match addresses and prefixes which are not
+// in a VRF
+const VrfGlobal = "global"
+
+// viewName matches the names of views, which are used as directory names
+var viewName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// matchClientKeywords are the address match list keywords of bind which
+// can be used in the clients of a view
+var matchClientKeywords = map[string]bool{
+	"any":       true,
+	"none":      true,
+	"localhost": true,
+	"localnets": true,
+}
+
+// View is a version of the zones served to a group of clients. The zones
+// of a view only contain the addresses and prefixes allowed by its filters.
+type View struct {
+	Name string
+	// Vrfs, Roles and Tenants filter addresses and prefixes on the name of
+	// their VRF, the slug of the role of their prefix and the slug of
+	// their tenant. Addresses and prefixes without a VRF are in the
+	// global VRF, see VrfGlobal.
+	Vrfs    common.Filter
+	Roles   common.Filter
+	Tenants common.Filter
+	// Public views never contain private, loopback or link local
+	// addresses, not even when they are configured in the dns_zones config
+	// context
+	Public bool
+	// MatchClients contains the addresses, prefixes and bind keywords of
+	// the clients served by the view, prefix them with ! to exclude them
+	MatchClients []string
+}
+
+// Validate returns an error if the name, the filters or the clients of the
+// view are invalid
+func (v View) Validate() error {
+	if !viewName.MatchString(v.Name) {
+		return fmt.Errorf("invalid view name: %q", v.Name)
+	}
+
+	if err := v.Vrfs.Validate(); err != nil {
+		return fmt.Errorf("vrfs: %v", err)
+	}
+
+	if err := v.Roles.Validate(); err != nil {
+		return fmt.Errorf("roles: %v", err)
+	}
+
+	if err := v.Tenants.Validate(); err != nil {
+		return fmt.Errorf("tenants: %v", err)
+	}
+
+	for _, client := range v.MatchClients {
+		if len(client) > 0 && client[0] == '!' {
+			client = client[1:]
+		}
+		if matchClientKeywords[client] {
+			continue
+		}
+		if _, err := parseNsAddresses([]string{client}, true); err != nil {
+			return fmt.Errorf("match_clients: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// allows returns true if an address or prefix with the given VRF, role and
+// tenant is part of the view. A nil view allows everything.
+func (v *View) allows(vrf, role, tenant string) bool {
+	if v == nil {
+		return true
+	}
+
+	if vrf == "" {
+		vrf = VrfGlobal
+	}
+
+	return v.Vrfs.Match(vrf) && v.Roles.Match(role) && v.Tenants.Match(tenant)
+}
+
+// allowsRecord returns false for address records with a private address
+// in public views
+func (v *View) allowsRecord(r Record) bool {
+	if v == nil || !v.Public || (r.Type != "A" && r.Type != "AAAA") {
+		return true
+	}
+
+	ip := net.ParseIP(r.Value)
+	return ip == nil || !common.IsPrivateAddress(ip)
+}
+
+// viewGenerators returns a copy of the generator for every view, which
+// writes to a directory named after the view below the output directory.
+// Without views, it returns the generator itself.
+func (g Generator) viewGenerators() []Generator {
+	if len(g.Views) == 0 {
+		return []Generator{g}
+	}
+
+	generators := []Generator{}
+	for idx := range g.Views {
+		vg := g
+		vg.view = &g.Views[idx]
+		vg.out = g.out + "/" + g.Views[idx].Name
+		generators = append(generators, vg)
+	}
+
+	return generators
+}
+
+// prefixList returns the prefixes which are part of the view of the
+// generator
+func (g Generator) prefixList(ctx context.Context) ([]common.Prefix, error) {
+	allPrefixes, err := g.client.ListPrefixes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListPrefixes: %v", err)
+	}
+
+	prefixes := []common.Prefix{}
+	for _, prefix := range allPrefixes {
+		if !g.view.allows(prefix.Vrf, prefix.Role, prefix.Tenant) {
+			continue
+		}
+		if g.view != nil && g.view.Public && common.IsPrivateNetwork(prefix.Network) {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
+
+// ipAddressList returns the addresses which are part of the view of the
+// generator. The role of an address is the role of the most specific
+// prefix containing it in the same VRF.
+func (g Generator) ipAddressList(ctx context.Context) ([]common.IpAddress, error) {
+	allIpAddresses, err := g.client.GetIpAddressList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetIpAddressList: %v", err)
+	}
+
+	if g.view == nil {
+		return allIpAddresses, nil
+	}
+
+	allPrefixes, err := g.client.ListPrefixes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ListPrefixes: %v", err)
+	}
+
+	ipAddresses := []common.IpAddress{}
+	for _, ipAddress := range allIpAddresses {
+		role := ""
+		bestOnes := -1
+		for _, prefix := range allPrefixes {
+			ones, _ := prefix.Network.Mask.Size()
+			if prefix.Vrf == ipAddress.Vrf && prefix.Network.Contains(ipAddress.Address) && ones > bestOnes {
+				role = prefix.Role
+				bestOnes = ones
+			}
+		}
+
+		if !g.view.allows(ipAddress.Vrf, role, ipAddress.Tenant) {
+			continue
+		}
+		if g.view.Public && common.IsPrivateAddress(ipAddress.Address) {
+			continue
+		}
+		ipAddresses = append(ipAddresses, ipAddress)
+	}
+
+	return ipAddresses, nil
+}
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+func TestViews(t *testing.T) {
+	g, _ := newTestGenerator(t)
+	out := g.out
+
+	g.Views = []View{
+		{Name: "internal", MatchClients: []string{"10.0.0.0/8", "localhost"}},
+		{Name: "external", Public: true},
+		{Name: "management", Vrfs: common.Filter{Include: []string{"internal"}}, Roles: common.Filter{Include: []string{"management"}}},
+	}
+	for _, view := range g.Views {
+		if err := view.Validate(); err != nil {
+			t.Fatalf("Validate %s: %v", view.Name, err)
+		}
+	}
+
+	ctx := context.Background()
+	if err := g.ReverseDNS(ctx, "1"); err != nil {
+		t.Fatalf("ReverseDNS: %v", err)
+	}
+	if err := g.ForwardDNS(ctx, "1"); err != nil {
+		t.Fatalf("ForwardDNS: %v", err)
+	}
+	if err := g.NameserverConfig(ctx, NameserverConfig{Formats: []string{NameserverBind}, ZoneDir: "/var/named"}); err != nil {
+		t.Fatalf("NameserverConfig: %v", err)
+	}
+
+	read := func(fname string) string {
+		t.Helper()
+		data, err := ioutil.ReadFile(filepath.Join(out, fname))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		fname    string
+		contains []string
+		missing  []string
+	}{
+		{"internal/db.as65342.net", []string{"server01 A 192.0.2.10", "server01-mgmt A 10.42.0.10"}, nil},
+		{"internal/db.42.10.in-addr.arpa", []string{"10.0 PTR server01-mgmt.as65342.net."}, nil},
+		{"external/db.as65342.net", []string{"server01 A 192.0.2.10"}, []string{"10.42.0.10"}},
+		{"management/db.as65342.net", []string{"server01-mgmt A 10.42.0.10"}, []string{"192.0.2.10"}},
+		{"management/db.42.10.in-addr.arpa", []string{"10.0 PTR server01-mgmt.as65342.net."}, nil},
+		{"internal/named.primary.conf", []string{`file "/var/named/internal/db.as65342.net";`}, nil},
+		{"named.views.primary.conf", []string{
+			"view \"internal\" {\n\tmatch-clients { 10.0.0.0/8; localhost; };\n\tinclude \"/var/named/internal/named.primary.conf\";\n};",
+			"view \"external\" {\n\tmatch-clients { any; };\n\tinclude \"/var/named/external/named.primary.conf\";\n};",
+		}, nil},
+	}
+
+	for _, test := range tests {
+		data := read(test.fname)
+		for _, s := range test.contains {
+			if !strings.Contains(data, s) {
+				t.Errorf("%s: expected %q in:\n%s", test.fname, s, data)
+			}
+		}
+		for _, s := range test.missing {
+			if strings.Contains(data, s) {
+				t.Errorf("%s: unexpected %q in:\n%s", test.fname, s, data)
+			}
+		}
+	}
+
+	// Private prefixes do not get a reverse zone in public views
+	for _, fname := range []string{"external/db.42.10.in-addr.arpa", "db.as65342.net"} {
+		if _, err := os.Stat(filepath.Join(out, fname)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no zone, got %v", fname, err)
+		}
+	}
+}
+
+func TestViewValidate(t *testing.T) {
+	invalid := []View{
+		{Name: ""},
+		{Name: "../public"},
+		{Name: "internal", Vrfs: common.Filter{Include: []string{"["}}},
+		{Name: "internal", MatchClients: []string{"ns.example.org"}},
+	}
+	for _, view := range invalid {
+		if err := view.Validate(); err == nil {
+			t.Errorf("Validate: expected an error for %+v", view)
+		}
+	}
+
+	public := &View{Name: "external", Public: true}
+	if public.allowsRecord(Record{Name: "ns", Type: "A", Value: "10.0.0.53"}) {
+		t.Errorf("allowsRecord: expected a private address to be dropped from a public view")
+	}
+	if !public.allowsRecord(Record{Name: "ns", Type: "A", Value: "192.0.2.53"}) {
+		t.Errorf("allowsRecord: expected a public address to be allowed")
+	}
+}
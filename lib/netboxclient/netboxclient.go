@@ -4,7 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/go-openapi/strfmt"
 
 	"github.com/r3boot/as65342-netbox/lib/common"
 	"github.com/r3boot/as65342-netbox/lib/netbox/client"
@@ -13,297 +18,752 @@ import (
 	"github.com/r3boot/as65342-netbox/lib/netbox/client/ipam"
 	"github.com/r3boot/as65342-netbox/lib/netbox/client/tenancy"
 	"github.com/r3boot/as65342-netbox/lib/netbox/client/virtualization"
+	"github.com/r3boot/as65342-netbox/lib/netbox/models"
 )
 
 type NetboxClient struct {
 	api                 *client.NetBox
 	token               common.TokenAuth
-	limit               int64
+	pageSize            int64
+	offline             bool
+	filters             common.Filters
+	mutex               sync.RWMutex
+	warnings            []common.Warning
 	ipamPrefixesList    *ipam.IpamPrefixesListOK
 	ipamIpAddressesList *ipam.IpamIPAddressesListOK
 	dcimDevicesList     *dcim.DcimDevicesListOK
 	virtualMachinesList *virtualization.VirtualizationVirtualMachinesListOK
 	configContextList   *extras.ExtrasConfigContextListOK
 	tenantList          *tenancy.TenancyTenantsListOK
+	ipamServicesList    *ipam.IpamServicesListOK
 }
 
-func NewNetboxClient(api *client.NetBox, token common.TokenAuth, limit int64) (client *NetboxClient, err error) {
+// NewNetboxClient returns a client which fetches all collections in pages
+// of pageSize entries. NetBox caps the page size to MAX_PAGE_SIZE, so the
+// client follows the next links until all results have been retrieved.
+func NewNetboxClient(api *client.NetBox, token common.TokenAuth, pageSize int64) (client *NetboxClient, err error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+
 	client = &NetboxClient{
-		api:   api,
-		token: token,
-		limit: limit,
+		api:      api,
+		token:    token,
+		pageSize: pageSize,
+		filters:  common.DefaultFilters(),
 	}
 
 	return client, nil
 }
 
-func (c *NetboxClient) UpdateIpamPrefixesList() (err error) {
-	if c.ipamPrefixesList == nil {
-		c.ipamPrefixesList, err = c.api.Ipam.IpamPrefixesList(&ipam.IpamPrefixesListParams{
-			Limit:   &c.limit,
-			Context: context.Background(),
+// SetFilters replaces the filters which decide which tenants, platforms and
+// statuses are managed. The defaults are returned by common.DefaultFilters.
+func (c *NetboxClient) SetFilters(filters common.Filters) {
+	c.filters = filters
+}
+
+// Filters returns the filters used by the client
+func (c *NetboxClient) Filters() common.Filters {
+	return c.filters
+}
+
+// nextOffset returns the offset referenced by the next link of a paginated
+// response, and false if there are no more pages to fetch.
+func nextOffset(next *strfmt.URI, current int64) (int64, bool, error) {
+	if next == nil || next.String() == "" {
+		return 0, false, nil
+	}
+
+	u, err := url.Parse(next.String())
+	if err != nil {
+		return 0, false, fmt.Errorf("url.Parse: %v", err)
+	}
+
+	value := u.Query().Get("offset")
+	if value == "" {
+		return 0, false, fmt.Errorf("no offset in next link: %s", next.String())
+	}
+
+	offset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("strconv.ParseInt: %v", err)
+	}
+
+	if offset <= current {
+		return 0, false, fmt.Errorf("next link does not advance: %s", next.String())
+	}
+
+	return offset, true, nil
+}
+
+func (c *NetboxClient) UpdateIpamPrefixesList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.ipamPrefixesList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
+	}
+
+	if c.offline {
+		return fmt.Errorf("prefixes not present in snapshot")
+	}
+
+	var result *ipam.IpamPrefixesListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Ipam.IpamPrefixesList(&ipam.IpamPrefixesListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
 		}, c.token)
 		if err != nil {
 			return fmt.Errorf("Ipam.IpamPrefixesList: %v", err)
 		}
+
+		if result == nil {
+			result = page
+		} else {
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
+		}
+
+		next, ok, err := nextOffset(page.Payload.Next, offset)
+		if err != nil {
+			return fmt.Errorf("nextOffset: %v", err)
+		}
+		if !ok {
+			break
+		}
+		offset = next
+	}
+	result.Payload.Next = nil
+
+	c.mutex.Lock()
+	if c.ipamPrefixesList == nil {
+		c.ipamPrefixesList = result
 	}
+	c.mutex.Unlock()
 
 	return nil
 }
 
-func (c *NetboxClient) UpdateIpamIpAddressesList() (err error) {
-	if c.ipamIpAddressesList == nil {
-		c.ipamIpAddressesList, err = c.api.Ipam.IpamIPAddressesList(&ipam.IpamIPAddressesListParams{
-			Limit:   &c.limit,
-			Context: context.Background(),
+func (c *NetboxClient) UpdateIpamIpAddressesList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.ipamIpAddressesList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
+	}
+
+	if c.offline {
+		return fmt.Errorf("ip addresses not present in snapshot")
+	}
+
+	var result *ipam.IpamIPAddressesListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Ipam.IpamIPAddressesList(&ipam.IpamIPAddressesListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
 		}, c.token)
 		if err != nil {
 			return fmt.Errorf("Ipam.IpamIPAddressesList: %v", err)
 		}
+
+		if result == nil {
+			result = page
+		} else {
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
+		}
+
+		next, ok, err := nextOffset(page.Payload.Next, offset)
+		if err != nil {
+			return fmt.Errorf("nextOffset: %v", err)
+		}
+		if !ok {
+			break
+		}
+		offset = next
+	}
+	result.Payload.Next = nil
+
+	c.mutex.Lock()
+	if c.ipamIpAddressesList == nil {
+		c.ipamIpAddressesList = result
 	}
+	c.mutex.Unlock()
 
 	return nil
 }
 
-func (c *NetboxClient) UpdateDcimDevicesList() (err error) {
-	if c.dcimDevicesList == nil {
-		c.dcimDevicesList, err = c.api.Dcim.DcimDevicesList(&dcim.DcimDevicesListParams{
-			Limit:   &c.limit,
-			Context: context.Background(),
+func (c *NetboxClient) UpdateDcimDevicesList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.dcimDevicesList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
+	}
+
+	if c.offline {
+		return fmt.Errorf("devices not present in snapshot")
+	}
+
+	var result *dcim.DcimDevicesListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Dcim.DcimDevicesList(&dcim.DcimDevicesListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
 		}, c.token)
 		if err != nil {
 			return fmt.Errorf("Dcim.DcimDevicesList: %v", err)
 		}
+
+		if result == nil {
+			result = page
+		} else {
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
+		}
+
+		next, ok, err := nextOffset(page.Payload.Next, offset)
+		if err != nil {
+			return fmt.Errorf("nextOffset: %v", err)
+		}
+		if !ok {
+			break
+		}
+		offset = next
+	}
+	result.Payload.Next = nil
+
+	c.mutex.Lock()
+	if c.dcimDevicesList == nil {
+		c.dcimDevicesList = result
 	}
+	c.mutex.Unlock()
 
 	return nil
 }
 
-func (c *NetboxClient) UpdateVirtualizationVirtualMachinesList() (err error) {
-	if c.virtualMachinesList == nil {
-		c.virtualMachinesList, err = c.api.Virtualization.VirtualizationVirtualMachinesList(&virtualization.VirtualizationVirtualMachinesListParams{
-			Limit:   &c.limit,
-			Context: context.Background(),
+func (c *NetboxClient) UpdateVirtualizationVirtualMachinesList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.virtualMachinesList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
+	}
+
+	if c.offline {
+		return fmt.Errorf("virtual machines not present in snapshot")
+	}
+
+	var result *virtualization.VirtualizationVirtualMachinesListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Virtualization.VirtualizationVirtualMachinesList(&virtualization.VirtualizationVirtualMachinesListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
 		}, c.token)
 		if err != nil {
 			return fmt.Errorf("Virtualization.VirtualizationVirtualMachinesList: %v", err)
 		}
+
+		if result == nil {
+			result = page
+		} else {
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
+		}
+
+		next, ok, err := nextOffset(page.Payload.Next, offset)
+		if err != nil {
+			return fmt.Errorf("nextOffset: %v", err)
+		}
+		if !ok {
+			break
+		}
+		offset = next
+	}
+	result.Payload.Next = nil
+
+	c.mutex.Lock()
+	if c.virtualMachinesList == nil {
+		c.virtualMachinesList = result
 	}
+	c.mutex.Unlock()
+
 	return nil
 }
 
-func (c *NetboxClient) UpdateExtrasConfigContextList() (err error) {
-	if c.configContextList == nil {
-		c.configContextList, err = c.api.Extras.ExtrasConfigContextList(&extras.ExtrasConfigContextListParams{
-			Limit:   &c.limit,
-			Context: context.Background(),
+func (c *NetboxClient) UpdateExtrasConfigContextList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.configContextList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
+	}
+
+	if c.offline {
+		return fmt.Errorf("config contexts not present in snapshot")
+	}
+
+	var result *extras.ExtrasConfigContextListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Extras.ExtrasConfigContextList(&extras.ExtrasConfigContextListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
 		}, c.token)
 		if err != nil {
 			return fmt.Errorf("Extras.ExtrasConfigContextList: %v", err)
 		}
-	}
 
-	return nil
-}
+		if result == nil {
+			result = page
+		} else {
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
+		}
 
-func (c *NetboxClient) UpdateTenancyTenantsList() (err error) {
-	if c.tenantList == nil {
-		c.tenantList, err = c.api.Tenancy.TenancyTenantsList(&tenancy.TenancyTenantsListParams{
-			Limit:   &c.limit,
-			Context: context.Background(),
-		}, c.token)
+		next, ok, err := nextOffset(page.Payload.Next, offset)
 		if err != nil {
-			return fmt.Errorf("Tenancy.TenancyTenantsList: %v", err)
+			return fmt.Errorf("nextOffset: %v", err)
+		}
+		if !ok {
+			break
 		}
+		offset = next
+	}
+	result.Payload.Next = nil
+
+	c.mutex.Lock()
+	if c.configContextList == nil {
+		c.configContextList = result
 	}
+	c.mutex.Unlock()
 
 	return nil
 }
 
-func (c *NetboxClient) GetPrefixList(tenant string) (allPrefixes []*net.IPNet, err error) {
-	err = c.UpdateIpamPrefixesList()
-	if err != nil {
-		return nil, fmt.Errorf("UpdateIpamPrefixesList: %v", err)
+func (c *NetboxClient) UpdateTenancyTenantsList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.tenantList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
 	}
 
-	for _, entry := range c.ipamPrefixesList.Payload.Results {
-		if !common.IsAllowedTenant(*entry.Tenant.Slug) {
-			continue
-		}
+	if c.offline {
+		return fmt.Errorf("tenants not present in snapshot")
+	}
 
-		_, network, err := net.ParseCIDR(*entry.Prefix)
+	var result *tenancy.TenancyTenantsListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Tenancy.TenancyTenantsList(&tenancy.TenancyTenantsListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
+		}, c.token)
 		if err != nil {
-			fmt.Printf("Failed to parse ip: %v\n", *entry.Prefix)
+			return fmt.Errorf("Tenancy.TenancyTenantsList: %v", err)
 		}
 
-		if len(network.IP) == 16 {
-			if size, _ := network.Mask.Size(); size != 64 {
-				continue
-			}
+		if result == nil {
+			result = page
 		} else {
-			if size, _ := network.Mask.Size(); size != 24 {
-				continue
-			}
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
 		}
 
-		allPrefixes = append(allPrefixes, network)
+		next, ok, err := nextOffset(page.Payload.Next, offset)
+		if err != nil {
+			return fmt.Errorf("nextOffset: %v", err)
+		}
+		if !ok {
+			break
+		}
+		offset = next
 	}
+	result.Payload.Next = nil
 
-	return allPrefixes, nil
+	c.mutex.Lock()
+	if c.tenantList == nil {
+		c.tenantList = result
+	}
+	c.mutex.Unlock()
+
+	return nil
 }
 
-func (c *NetboxClient) GetIpAddressList(tenant string) (allIpAddresses []common.IpAddress, err error) {
-	err = c.UpdateIpamIpAddressesList()
-	if err != nil {
-		return nil, fmt.Errorf("UpdateIpamIpAddressesList: %v", err)
+func (c *NetboxClient) UpdateIpamServicesList(ctx context.Context) error {
+	c.mutex.RLock()
+	cached := c.ipamServicesList != nil
+	c.mutex.RUnlock()
+	if cached {
+		return nil
 	}
 
-	for _, entry := range c.ipamIpAddressesList.Payload.Results {
-		ipAddress := common.IpAddress{
-			Dns:    entry.DNSName,
-			Tenant: *entry.Tenant.Slug,
+	if c.offline {
+		return fmt.Errorf("services not present in snapshot")
+	}
+
+	var result *ipam.IpamServicesListOK
+	offset := int64(0)
+	for {
+		page, err := c.api.Ipam.IpamServicesList(&ipam.IpamServicesListParams{
+			Limit:   &c.pageSize,
+			Offset:  &offset,
+			Context: ctx,
+		}, c.token)
+		if err != nil {
+			return fmt.Errorf("Ipam.IpamServicesList: %v", err)
 		}
 
-		ipAddress.Address, ipAddress.Network, err = net.ParseCIDR(*entry.Address)
+		if result == nil {
+			result = page
+		} else {
+			result.Payload.Results = append(result.Payload.Results, page.Payload.Results...)
+		}
+
+		next, ok, err := nextOffset(page.Payload.Next, offset)
 		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+			return fmt.Errorf("nextOffset: %v", err)
 		}
+		if !ok {
+			break
+		}
+		offset = next
+	}
+	result.Payload.Next = nil
 
-		allIpAddresses = append(allIpAddresses, ipAddress)
+	c.mutex.Lock()
+	if c.ipamServicesList == nil {
+		c.ipamServicesList = result
 	}
-	return allIpAddresses, nil
+	c.mutex.Unlock()
+
+	return nil
 }
 
-func (c *NetboxClient) GetHostList() (allDevices []common.ManagedDevice, err error) {
-	err = c.UpdateDcimDevicesList()
+func (c *NetboxClient) GetPrefixList(ctx context.Context) (allPrefixes []*net.IPNet, err error) {
+	prefixes, err := c.ListPrefixes(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("UpdateDcimDevicesList: %v", err)
+		return nil, fmt.Errorf("ListPrefixes: %v", err)
+	}
+
+	for _, prefix := range prefixes {
+		allPrefixes = append(allPrefixes, prefix.Network)
 	}
 
-	err = c.UpdateVirtualizationVirtualMachinesList()
+	return allPrefixes, nil
+}
+
+// ListPrefixes returns the prefixes of the managed tenants, together with
+// their VRF and role
+func (c *NetboxClient) ListPrefixes(ctx context.Context) (prefixes []common.Prefix, err error) {
+	err = c.UpdateIpamPrefixesList(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("UpdateVirtualizationVirtualMachinesList: %v", err)
+		return nil, fmt.Errorf("UpdateIpamPrefixesList: %v", err)
 	}
 
-	// Get details for physical systems
-	for _, entry := range c.dcimDevicesList.Payload.Results {
-		if !common.IsAllowedTenant(*entry.Tenant.Slug) {
+	for _, entry := range c.ipamPrefixesList.Payload.Results {
+		if entry.Prefix == nil {
+			c.warn(ObjectPrefix, entry.ID, "", "has no prefix")
 			continue
 		}
 
-		if !common.IsAllowedStatus(*entry.Status.Label) {
+		if entry.Tenant == nil || entry.Tenant.Slug == nil {
+			c.warn(ObjectPrefix, entry.ID, *entry.Prefix, "has no tenant")
 			continue
 		}
 
-		if entry.Platform == nil {
+		if !c.filters.Tenants.Match(*entry.Tenant.Slug) {
 			continue
 		}
 
-		if !common.IsAllowedPlatform(*entry.Platform.Slug) {
+		_, network, err := net.ParseCIDR(*entry.Prefix)
+		if err != nil {
+			c.warn(ObjectPrefix, entry.ID, *entry.Prefix, "is not a valid prefix: %v", err)
 			continue
 		}
 
-		device := common.ManagedDevice{
-			Name:     entry.Name,
-			Tags:     entry.Tags,
-			Tenant:   *entry.Tenant.Slug,
-			Platform: *entry.Platform.Slug,
-			Site:     *entry.Site.Slug,
-			Config:   entry.ConfigContext,
+		prefix := common.Prefix{
+			ID:      entry.ID,
+			Network: network,
+			Tenant:  *entry.Tenant.Slug,
 		}
 
-		device.PrimaryIP, device.PrimaryNet, err = net.ParseCIDR(*entry.PrimaryIP.Address)
-		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+		if entry.Vrf != nil && entry.Vrf.Name != nil {
+			prefix.Vrf = *entry.Vrf.Name
 		}
-		device.PrintablePrimaryNet = device.PrimaryNet.IP.String()
-		device.PrintablePrimaryNet = strings.Replace(device.PrintablePrimaryNet, "/24", "", -1)
-		device.PrintablePrimaryNet = strings.Replace(device.PrintablePrimaryNet, ".", "-", -1)
 
-		device.PrimaryIP4, device.PrimaryNet4, err = net.ParseCIDR(*entry.PrimaryIp4.Address)
-		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+		if entry.Role != nil && entry.Role.Slug != nil {
+			prefix.Role = *entry.Role.Slug
 		}
-		device.PrintablePrimaryNet4 = device.PrimaryNet4.IP.String()
-		device.PrintablePrimaryNet4 = strings.Replace(device.PrintablePrimaryNet4, "/24", "", -1)
-		device.PrintablePrimaryNet4 = strings.Replace(device.PrintablePrimaryNet4, ".", "-", -1)
 
-		device.PrimaryIP6, device.PrimaryNet6, err = net.ParseCIDR(*entry.PrimaryIp6.Address)
-		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
-		}
-		device.PrintablePrimaryNet6 = device.PrimaryNet6.IP.String()
-		device.PrintablePrimaryNet6 = strings.Replace(device.PrintablePrimaryNet6, "::", "", -1)
-		device.PrintablePrimaryNet6 = strings.Replace(device.PrintablePrimaryNet6, ":", "-", -1)
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
 
-		allDevices = append(allDevices, device)
+func (c *NetboxClient) GetIpAddressList(ctx context.Context) (allIpAddresses []common.IpAddress, err error) {
+	err = c.UpdateIpamIpAddressesList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateIpamIpAddressesList: %v", err)
 	}
 
-	// Get details for virtual machines
-	for _, entry := range c.virtualMachinesList.Payload.Results {
-		if !common.IsAllowedTenant(*entry.Tenant.Slug) {
+	for _, entry := range c.ipamIpAddressesList.Payload.Results {
+		if entry.Address == nil {
+			c.warn(ObjectIpAddress, entry.ID, "", "has no address")
 			continue
 		}
 
-		if !common.IsAllowedStatus(*entry.Status.Label) {
-			continue
+		ipAddress := common.IpAddress{
+			ID:  entry.ID,
+			Dns: entry.DNSName,
 		}
 
-		if entry.Platform == nil {
-			continue
+		if entry.Role != nil && entry.Role.Label != nil {
+			ipAddress.Role = *entry.Role.Label
 		}
 
-		if !common.IsAllowedPlatform(*entry.Platform.Slug) {
-			continue
+		if entry.Vrf != nil && entry.Vrf.Name != nil {
+			ipAddress.Vrf = *entry.Vrf.Name
 		}
 
-		device := common.ManagedDevice{
-			Name:     *entry.Name,
-			Tags:     entry.Tags,
-			Tenant:   *entry.Tenant.Slug,
-			Platform: *entry.Platform.Slug,
-			Site:     *entry.Site.Slug,
-			Config:   entry.ConfigContext,
+		if entry.Interface != nil {
+			switch {
+			case entry.Interface.Device != nil:
+				ipAddress.Host = entry.Interface.Device.Name
+			case entry.Interface.VirtualMachine != nil && entry.Interface.VirtualMachine.Name != nil:
+				ipAddress.Host = *entry.Interface.VirtualMachine.Name
+			}
+		}
+
+		if fields, ok := entry.CustomFields.(map[string]interface{}); ok {
+			ipAddress.CustomFields = fields
 		}
 
-		device.PrimaryIP, device.PrimaryNet, err = net.ParseCIDR(*entry.PrimaryIP.Address)
+		if entry.Tenant != nil && entry.Tenant.Slug != nil {
+			ipAddress.Tenant = *entry.Tenant.Slug
+		} else {
+			c.warn(ObjectIpAddress, entry.ID, *entry.Address, "has no tenant")
+		}
+
+		ipAddress.Address, ipAddress.Network, err = net.ParseCIDR(*entry.Address)
 		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+			c.warn(ObjectIpAddress, entry.ID, *entry.Address, "is not a valid address: %v", err)
+			continue
 		}
-		device.PrintablePrimaryNet = device.PrimaryNet.IP.String()
-		device.PrintablePrimaryNet = strings.Replace(device.PrintablePrimaryNet, "/24", "", -1)
-		device.PrintablePrimaryNet = strings.Replace(device.PrintablePrimaryNet, ".", "-", -1)
 
-		device.PrimaryIP4, device.PrimaryNet4, err = net.ParseCIDR(*entry.PrimaryIp4.Address)
+		allIpAddresses = append(allIpAddresses, ipAddress)
+	}
+	return allIpAddresses, nil
+}
+
+// hostEntry contains the fields of a device or virtual machine which are
+// used to build a common.ManagedDevice. All fields are optional in NetBox.
+type hostEntry struct {
+	object     string
+	id         int64
+	name       string
+	tenant     *models.NestedTenant
+	status     *string
+	platform   *models.NestedPlatform
+	site       *models.NestedSite
+	primaryIP  *string
+	primaryIP4 *string
+	primaryIP6 *string
+	tags       []string
+	config     interface{}
+}
+
+// toManagedDevice converts entry into a common.ManagedDevice. It returns
+// false if the entry is filtered out or cannot be used, in which case a
+// warning is recorded for entries with incomplete data.
+func (c *NetboxClient) toManagedDevice(entry hostEntry) (device common.ManagedDevice, ok bool) {
+	if entry.name == "" {
+		c.warn(entry.object, entry.id, entry.name, "has no name")
+		return device, false
+	}
+
+	if entry.tenant == nil || entry.tenant.Slug == nil {
+		c.warn(entry.object, entry.id, entry.name, "has no tenant")
+		return device, false
+	}
+
+	if !c.filters.Tenants.Match(*entry.tenant.Slug) {
+		return device, false
+	}
+
+	if entry.status == nil {
+		c.warn(entry.object, entry.id, entry.name, "has no status")
+		return device, false
+	}
+
+	if !c.filters.Statuses.Match(*entry.status) {
+		return device, false
+	}
+
+	if entry.platform == nil || entry.platform.Slug == nil {
+		return device, false
+	}
+
+	if !c.filters.Platforms.Match(*entry.platform.Slug) {
+		return device, false
+	}
+
+	device = common.ManagedDevice{
+		Object:   entry.object,
+		ID:       entry.id,
+		Name:     entry.name,
+		Tags:     entry.tags,
+		Tenant:   *entry.tenant.Slug,
+		Status:   *entry.status,
+		Platform: *entry.platform.Slug,
+		Config:   entry.config,
+	}
+
+	if entry.site != nil && entry.site.Slug != nil {
+		device.Site = *entry.site.Slug
+	} else {
+		c.warn(entry.object, entry.id, entry.name, "has no site")
+	}
+
+	var err error
+	if entry.primaryIP4 != nil {
+		device.PrimaryIP4, device.PrimaryNet4, err = net.ParseCIDR(*entry.primaryIP4)
 		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+			c.warn(entry.object, entry.id, entry.name, "has an invalid primary ipv4 address: %v", err)
+			return device, false
 		}
 		device.PrintablePrimaryNet4 = device.PrimaryNet4.IP.String()
 		device.PrintablePrimaryNet4 = strings.Replace(device.PrintablePrimaryNet4, "/24", "", -1)
 		device.PrintablePrimaryNet4 = strings.Replace(device.PrintablePrimaryNet4, ".", "-", -1)
+	}
 
-		device.PrimaryIP6, device.PrimaryNet6, err = net.ParseCIDR(*entry.PrimaryIp6.Address)
+	if entry.primaryIP6 != nil {
+		device.PrimaryIP6, device.PrimaryNet6, err = net.ParseCIDR(*entry.primaryIP6)
 		if err != nil {
-			return nil, fmt.Errorf("net.ParseCIDR: %v", err)
+			c.warn(entry.object, entry.id, entry.name, "has an invalid primary ipv6 address: %v", err)
+			return device, false
 		}
 		device.PrintablePrimaryNet6 = device.PrimaryNet6.IP.String()
 		device.PrintablePrimaryNet6 = strings.Replace(device.PrintablePrimaryNet6, "::", "", -1)
 		device.PrintablePrimaryNet6 = strings.Replace(device.PrintablePrimaryNet6, ":", "-", -1)
+	}
+
+	// Fall back to the address family which is available if NetBox did not
+	// select a primary address
+	switch {
+	case entry.primaryIP != nil:
+		device.PrimaryIP, device.PrimaryNet, err = net.ParseCIDR(*entry.primaryIP)
+		if err != nil {
+			c.warn(entry.object, entry.id, entry.name, "has an invalid primary address: %v", err)
+			return device, false
+		}
+	case device.PrimaryIP4 != nil:
+		device.PrimaryIP, device.PrimaryNet = device.PrimaryIP4, device.PrimaryNet4
+	case device.PrimaryIP6 != nil:
+		device.PrimaryIP, device.PrimaryNet = device.PrimaryIP6, device.PrimaryNet6
+	default:
+		c.warn(entry.object, entry.id, entry.name, "has no primary address")
+		return device, false
+	}
+	device.PrintablePrimaryNet = device.PrimaryNet.IP.String()
+	device.PrintablePrimaryNet = strings.Replace(device.PrintablePrimaryNet, "/24", "", -1)
+	device.PrintablePrimaryNet = strings.Replace(device.PrintablePrimaryNet, ".", "-", -1)
+
+	return device, true
+}
+
+func (c *NetboxClient) GetHostList(ctx context.Context) (allDevices []common.ManagedDevice, err error) {
+	err = c.UpdateDcimDevicesList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateDcimDevicesList: %v", err)
+	}
+
+	err = c.UpdateVirtualizationVirtualMachinesList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateVirtualizationVirtualMachinesList: %v", err)
+	}
+
+	// Get details for physical systems
+	for _, entry := range c.dcimDevicesList.Payload.Results {
+		host := hostEntry{
+			object:   ObjectDevice,
+			id:       entry.ID,
+			name:     entry.Name,
+			tenant:   entry.Tenant,
+			platform: entry.Platform,
+			site:     entry.Site,
+			tags:     entry.Tags,
+			config:   entry.ConfigContext,
+		}
+		if entry.Status != nil {
+			host.status = entry.Status.Label
+		}
+		if entry.PrimaryIP != nil {
+			host.primaryIP = entry.PrimaryIP.Address
+		}
+		if entry.PrimaryIp4 != nil {
+			host.primaryIP4 = entry.PrimaryIp4.Address
+		}
+		if entry.PrimaryIp6 != nil {
+			host.primaryIP6 = entry.PrimaryIp6.Address
+		}
+
+		if device, ok := c.toManagedDevice(host); ok {
+			allDevices = append(allDevices, device)
+		}
+	}
+
+	// Get details for virtual machines
+	for _, entry := range c.virtualMachinesList.Payload.Results {
+		host := hostEntry{
+			object:   ObjectVirtualMachine,
+			id:       entry.ID,
+			tenant:   entry.Tenant,
+			platform: entry.Platform,
+			site:     entry.Site,
+			tags:     entry.Tags,
+			config:   entry.ConfigContext,
+		}
+		if entry.Name != nil {
+			host.name = *entry.Name
+		}
+		if entry.Status != nil {
+			host.status = entry.Status.Label
+		}
+		if entry.PrimaryIP != nil {
+			host.primaryIP = entry.PrimaryIP.Address
+		}
+		if entry.PrimaryIp4 != nil {
+			host.primaryIP4 = entry.PrimaryIp4.Address
+		}
+		if entry.PrimaryIp6 != nil {
+			host.primaryIP6 = entry.PrimaryIp6.Address
+		}
 
-		allDevices = append(allDevices, device)
+		if device, ok := c.toManagedDevice(host); ok {
+			allDevices = append(allDevices, device)
+		}
 	}
 
 	return allDevices, nil
 }
 
-func (c *NetboxClient) ListConfigContexts() (contexts []common.ConfigContext, err error) {
-	err = c.UpdateExtrasConfigContextList()
+func (c *NetboxClient) ListConfigContexts(ctx context.Context) (contexts []common.ConfigContext, err error) {
+	err = c.UpdateExtrasConfigContextList(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("UpdateExtrasConfigContextList: %v", err)
 	}
 
 	for _, entry := range c.configContextList.Payload.Results {
 		context := common.ConfigContext{
+			ID:     entry.ID,
 			Name:   *entry.Name,
 			Config: entry.Data,
 		}
@@ -313,8 +773,50 @@ func (c *NetboxClient) ListConfigContexts() (contexts []common.ConfigContext, er
 	return contexts, nil
 }
 
-func (c *NetboxClient) ListTenants() (tenants []common.Tenant, err error) {
-	err = c.UpdateTenancyTenantsList()
+// ListServices returns the services of all devices and virtual machines
+func (c *NetboxClient) ListServices(ctx context.Context) (services []common.Service, err error) {
+	err = c.UpdateIpamServicesList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateIpamServicesList: %v", err)
+	}
+
+	for _, entry := range c.ipamServicesList.Payload.Results {
+		if entry.Name == nil || entry.Port == nil || entry.Protocol == nil || entry.Protocol.Label == nil {
+			c.warn(ObjectService, entry.ID, "", "has no name, port or protocol")
+			continue
+		}
+
+		service := common.Service{
+			ID:       entry.ID,
+			Name:     *entry.Name,
+			Protocol: strings.ToLower(*entry.Protocol.Label),
+			Port:     *entry.Port,
+		}
+
+		switch {
+		case entry.Device != nil:
+			service.Host = entry.Device.Name
+		case entry.VirtualMachine != nil && entry.VirtualMachine.Name != nil:
+			service.Host = *entry.VirtualMachine.Name
+		default:
+			c.warn(ObjectService, entry.ID, service.Name, "has no device or virtual machine")
+			continue
+		}
+
+		for _, ipAddress := range entry.Ipaddresses {
+			if ipAddress != nil {
+				service.IpAddresses = append(service.IpAddresses, ipAddress.ID)
+			}
+		}
+
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (c *NetboxClient) ListTenants(ctx context.Context) (tenants []common.Tenant, err error) {
+	err = c.UpdateTenancyTenantsList(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("UpdateTenancyTenantsList: %v", err)
 	}
@@ -330,20 +832,24 @@ func (c *NetboxClient) ListTenants() (tenants []common.Tenant, err error) {
 	return tenants, nil
 }
 
-func (c *NetboxClient) ListGateways() (gateways []common.Gateway, err error) {
-	err = c.UpdateDcimDevicesList()
+func (c *NetboxClient) ListGateways(ctx context.Context) (gateways []common.Gateway, err error) {
+	err = c.UpdateDcimDevicesList(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("UpdateDcimDevicesList: %v", err)
 	}
 
-	err = c.UpdateVirtualizationVirtualMachinesList()
+	err = c.UpdateVirtualizationVirtualMachinesList(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("UpdateVirtualizationVirtualMachinesList: %v", err)
 	}
 
 	for _, entry := range c.dcimDevicesList.Payload.Results {
+		if entry.Tenant == nil || entry.Tenant.Slug == nil {
+			continue
+		}
+
 		tenant := *entry.Tenant.Slug
-		if entry.PrimaryIp4 != nil {
+		if entry.PrimaryIp4 != nil && entry.PrimaryIp4.Address != nil {
 			_, primary_net4, err := net.ParseCIDR(*entry.PrimaryIp4.Address)
 			if err != nil {
 				return nil, fmt.Errorf("net.ParseCIDR: %v", err)
@@ -374,7 +880,7 @@ func (c *NetboxClient) ListGateways() (gateways []common.Gateway, err error) {
 			}
 		}
 
-		if entry.PrimaryIp6 != nil {
+		if entry.PrimaryIp6 != nil && entry.PrimaryIp6.Address != nil {
 			_, primary_net6, err := net.ParseCIDR(*entry.PrimaryIp6.Address)
 			if err != nil {
 				return nil, fmt.Errorf("net.ParseCIDR: %v", err)
@@ -407,8 +913,12 @@ func (c *NetboxClient) ListGateways() (gateways []common.Gateway, err error) {
 	}
 
 	for _, entry := range c.virtualMachinesList.Payload.Results {
+		if entry.Tenant == nil || entry.Tenant.Slug == nil {
+			continue
+		}
+
 		tenant := *entry.Tenant.Slug
-		if entry.PrimaryIp4 != nil {
+		if entry.PrimaryIp4 != nil && entry.PrimaryIp4.Address != nil {
 			_, primary_net4, err := net.ParseCIDR(*entry.PrimaryIp4.Address)
 			if err != nil {
 				return nil, fmt.Errorf("net.ParseCIDR: %v", err)
@@ -439,7 +949,7 @@ func (c *NetboxClient) ListGateways() (gateways []common.Gateway, err error) {
 			}
 		}
 
-		if entry.PrimaryIp6 != nil {
+		if entry.PrimaryIp6 != nil && entry.PrimaryIp6.Address != nil {
 			_, primary_net6, err := net.ParseCIDR(*entry.PrimaryIp6.Address)
 			if err != nil {
 				return nil, fmt.Errorf("net.ParseCIDR: %v", err)
@@ -0,0 +1,244 @@
+package netboxclient_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+	"github.com/r3boot/as65342-netbox/lib/netboxtest"
+)
+
+func newTestServer(t *testing.T) *netboxtest.Server {
+	t.Helper()
+
+	server, err := netboxtest.NewServer(netboxtest.FixtureDir())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestPagination(t *testing.T) {
+	server := newTestServer(t)
+	server.MaxPageSize = 3
+
+	// Request more than MaxPageSize, so the client has to follow the
+	// next links returned by the server
+	c, err := server.Client(5)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	ipAddresses, err := c.GetIpAddressList(context.Background())
+	if err != nil {
+		t.Fatalf("GetIpAddressList: %v", err)
+	}
+
+	if len(ipAddresses) != 20 {
+		t.Errorf("expected 20 ip addresses, got %d", len(ipAddresses))
+	}
+
+	if n := server.Requests("/ipam/ip-addresses/"); n != 7 {
+		t.Errorf("expected 7 requests, got %d", n)
+	}
+
+	// The collection is cached after the first call
+	_, err = c.GetIpAddressList(context.Background())
+	if err != nil {
+		t.Fatalf("GetIpAddressList: %v", err)
+	}
+
+	if n := server.Requests("/ipam/ip-addresses/"); n != 7 {
+		t.Errorf("expected 7 requests after second call, got %d", n)
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	server := newTestServer(t)
+
+	c, err := server.Client(100)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+	server.Token = "invalid"
+
+	_, err = c.ListTenants(context.Background())
+	if err == nil {
+		t.Fatalf("expected an error for an invalid token")
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	server := newTestServer(t)
+
+	c, err := server.Client(2)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	err = c.Prefetch(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+
+	for endpoint := range netboxtest.Endpoints {
+		if server.Requests(endpoint) == 0 {
+			t.Errorf("%s was not fetched", endpoint)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	server := newTestServer(t)
+
+	c, err := server.Client(100)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	if _, err := c.GetIpAddressList(context.Background()); err != nil {
+		t.Fatalf("GetIpAddressList: %v", err)
+	}
+
+	objects := server.Objects("/ipam/ip-addresses/")
+	server.SetObjects("/ipam/ip-addresses/", objects[:1])
+
+	ips, _ := c.GetIpAddressList(context.Background())
+	if len(ips) != len(objects) {
+		t.Errorf("expected the cached %d addresses, got %d", len(objects), len(ips))
+	}
+
+	c.Invalidate(netboxclient.IpAddresses)
+	ips, err = c.GetIpAddressList(context.Background())
+	if err != nil {
+		t.Fatalf("GetIpAddressList: %v", err)
+	}
+	if len(ips) != 1 {
+		t.Errorf("expected 1 address after Invalidate, got %d", len(ips))
+	}
+	if server.Requests("/ipam/ip-addresses/") != 2 {
+		t.Errorf("expected 2 requests, got %d", server.Requests("/ipam/ip-addresses/"))
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	server := newTestServer(t)
+
+	c, err := server.Client(100)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = c.GetHostList(ctx)
+	if err == nil {
+		t.Fatalf("expected an error for a cancelled context")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	server := newTestServer(t)
+
+	c, err := server.Client(100)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	err = c.Prefetch(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("Prefetch: %v", err)
+	}
+
+	fname := filepath.Join(t.TempDir(), "snapshot.json")
+	err = c.WriteSnapshot(fname)
+	if err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+
+	expected, err := c.GetHostList(context.Background())
+	if err != nil {
+		t.Fatalf("GetHostList: %v", err)
+	}
+
+	server.Close()
+
+	offline, err := netboxclient.NewNetboxClientFromSnapshot(fname)
+	if err != nil {
+		t.Fatalf("NewNetboxClientFromSnapshot: %v", err)
+	}
+
+	hosts, err := offline.GetHostList(context.Background())
+	if err != nil {
+		t.Fatalf("GetHostList: %v", err)
+	}
+
+	if len(hosts) != len(expected) {
+		t.Fatalf("expected %d hosts, got %d", len(expected), len(hosts))
+	}
+	for idx := range hosts {
+		if hosts[idx].Name != expected[idx].Name {
+			t.Errorf("expected host %s, got %s", expected[idx].Name, hosts[idx].Name)
+		}
+	}
+}
+
+func TestHostListWarnings(t *testing.T) {
+	server := newTestServer(t)
+
+	c, err := server.Client(100)
+	if err != nil {
+		t.Fatalf("Client: %v", err)
+	}
+
+	hosts, err := c.GetHostList(context.Background())
+	if err != nil {
+		t.Fatalf("GetHostList: %v", err)
+	}
+
+	found := false
+	for _, host := range hosts {
+		if host.Name != "vm02.as65342.net" {
+			continue
+		}
+		found = true
+
+		if !host.HasIPv4() || host.HasIPv6() {
+			t.Errorf("expected %s to be ipv4-only", host.Name)
+		}
+		if !host.PrimaryIP.Equal(host.PrimaryIP4) {
+			t.Errorf("expected primary ip %s, got %s", host.PrimaryIP4, host.PrimaryIP)
+		}
+	}
+	if !found {
+		t.Errorf("ipv4-only host vm02.as65342.net is missing")
+	}
+
+	expected := map[string]string{
+		"pdu01.as65342.net": "has no tenant",
+		"vm03.as65342.net":  "has no primary address",
+	}
+	for _, warning := range c.Warnings() {
+		if expected[warning.Name] == warning.Message {
+			delete(expected, warning.Name)
+		}
+	}
+	for name, message := range expected {
+		t.Errorf("missing warning for %s: %s", name, message)
+	}
+}
+
+func TestWebURL(t *testing.T) {
+	url := netboxclient.WebURL("https://netbox.example.org/", netboxclient.ObjectIpAddress, 18)
+	if url != "https://netbox.example.org/ipam/ip-addresses/18/" {
+		t.Errorf("WebURL: expected the web interface url, got %s", url)
+	}
+
+	if url := netboxclient.WebURL("https://netbox.example.org", "unknown", 1); url != "" {
+		t.Errorf("WebURL: expected no url for an unknown object, got %s", url)
+	}
+}
@@ -0,0 +1,132 @@
+package netboxclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type Collection string
+
+const (
+	Prefixes        Collection = "prefixes"
+	IpAddresses     Collection = "ip-addresses"
+	Devices         Collection = "devices"
+	VirtualMachines Collection = "virtual-machines"
+	ConfigContexts  Collection = "config-contexts"
+	Tenants         Collection = "tenants"
+	Services        Collection = "services"
+)
+
+var AllCollections []Collection = []Collection{
+	Prefixes,
+	IpAddresses,
+	Devices,
+	VirtualMachines,
+	ConfigContexts,
+	Tenants,
+	Services,
+}
+
+func (c *NetboxClient) update(ctx context.Context, collection Collection) error {
+	switch collection {
+	case Prefixes:
+		return c.UpdateIpamPrefixesList(ctx)
+	case IpAddresses:
+		return c.UpdateIpamIpAddressesList(ctx)
+	case Devices:
+		return c.UpdateDcimDevicesList(ctx)
+	case VirtualMachines:
+		return c.UpdateVirtualizationVirtualMachinesList(ctx)
+	case ConfigContexts:
+		return c.UpdateExtrasConfigContextList(ctx)
+	case Tenants:
+		return c.UpdateTenancyTenantsList(ctx)
+	case Services:
+		return c.UpdateIpamServicesList(ctx)
+	}
+
+	return fmt.Errorf("unknown collection: %s", collection)
+}
+
+// Invalidate drops the cached copies of the given collections, so they are
+// fetched again the next time they are used. Offline clients keep serving
+// their snapshot.
+func (c *NetboxClient) Invalidate(collections ...Collection) {
+	if c.offline {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, collection := range collections {
+		switch collection {
+		case Prefixes:
+			c.ipamPrefixesList = nil
+		case IpAddresses:
+			c.ipamIpAddressesList = nil
+		case Devices:
+			c.dcimDevicesList = nil
+		case VirtualMachines:
+			c.virtualMachinesList = nil
+		case ConfigContexts:
+			c.configContextList = nil
+		case Tenants:
+			c.tenantList = nil
+		case Services:
+			c.ipamServicesList = nil
+		}
+	}
+}
+
+// Prefetch fetches the given collections in parallel, with at most
+// concurrency collections being fetched at the same time. All collections
+// are fetched if none are given. The first error encountered cancels the
+// remaining requests.
+func (c *NetboxClient) Prefetch(ctx context.Context, concurrency int, collections ...Collection) error {
+	if len(collections) == 0 {
+		collections = AllCollections
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, concurrency)
+
+	for _, collection := range collections {
+		wg.Add(1)
+		go func(collection Collection) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err := c.update(ctx, collection); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s: %v", collection, err)
+					cancel()
+				})
+			}
+		}(collection)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return firstErr
+}
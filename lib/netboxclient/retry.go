@@ -0,0 +1,143 @@
+package netboxclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryTransport is a http.RoundTripper which retries idempotent requests
+// that failed because of a transient error. Server errors, rate limiting
+// and connection resets are retried using an exponential backoff with
+// jitter, while a Retry-After header sent by the server takes precedence up
+// to MaxBackoff.
+type RetryTransport struct {
+	Transport  http.RoundTripper
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	retries    int64
+}
+
+func NewRetryTransport(transport http.RoundTripper, maxRetries int, minBackoff, maxBackoff time.Duration) *RetryTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &RetryTransport{
+		Transport:  transport,
+		MaxRetries: maxRetries,
+		MinBackoff: minBackoff,
+		MaxBackoff: maxBackoff,
+	}
+}
+
+// Retries returns the total number of retried requests
+func (t *RetryTransport) Retries() int64 {
+	return atomic.LoadInt64(&t.retries)
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.Transport.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.Transport.RoundTrip(req)
+		if attempt >= t.MaxRetries || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+				if wait > t.MaxBackoff {
+					wait = t.MaxBackoff
+				}
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		atomic.AddInt64(&t.retries, 1)
+		// Printed to stderr, since stdout may contain json output
+		fmt.Fprintf(os.Stderr, "WARNING: %s %s: %s, retrying in %v (%d/%d)\n", req.Method, req.URL, reason, wait, attempt+1, t.MaxRetries)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the time to wait before the next attempt, which doubles
+// for every attempt up to MaxBackoff. Half of the delay is randomized to
+// avoid all clients retrying at the same time.
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	wait := t.MinBackoff
+	for i := 0; i < attempt && wait < t.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > t.MaxBackoff {
+		wait = t.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or a http date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	when, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	wait := time.Until(when)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
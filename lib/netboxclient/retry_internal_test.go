@@ -0,0 +1,65 @@
+package netboxclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	transport := NewRetryTransport(nil, 10, 100*time.Millisecond, time.Second)
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond, 800 * time.Millisecond},
+		{4, 500 * time.Millisecond, time.Second},
+		{20, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			wait := transport.backoff(test.attempt)
+			if wait < test.min || wait > test.max {
+				t.Fatalf("backoff(%d): expected between %v and %v, got %v", test.attempt, test.min, test.max, wait)
+			}
+		}
+	}
+
+	transport.MinBackoff = 0
+	if wait := transport.backoff(3); wait != 0 {
+		t.Errorf("expected no backoff without MinBackoff, got %v", wait)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+
+	for _, test := range tests {
+		wait, ok := parseRetryAfter(test.value)
+		if wait != test.expected || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q): expected %v %v, got %v %v", test.value, test.expected, test.ok, wait, ok)
+		}
+	}
+
+	// A http date in the future is converted to the time until that date
+	when := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	wait, ok := parseRetryAfter(when)
+	if !ok || wait <= 58*time.Minute || wait > time.Hour {
+		t.Errorf("parseRetryAfter(%q): expected about an hour, got %v %v", when, wait, ok)
+	}
+}
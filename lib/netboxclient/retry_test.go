@@ -0,0 +1,76 @@
+package netboxclient_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/r3boot/as65342-netbox/lib/netbox/client"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+	"github.com/r3boot/as65342-netbox/lib/netboxtest"
+)
+
+const retryEndpoint = "/ipam/ip-addresses/"
+
+// getWithRetries requests endpoint on server using a RetryTransport, and
+// returns the status of the final response
+func getWithRetries(t *testing.T, server *netboxtest.Server, transport *netboxclient.RetryTransport) int {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+client.DefaultBasePath+retryEndpoint, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Token "+server.Token)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		status     int
+		retryAfter string
+		expected   int
+		retries    int64
+	}{
+		{"server error", 2, http.StatusServiceUnavailable, "", http.StatusOK, 2},
+		{"rate limited", 2, http.StatusTooManyRequests, "", http.StatusOK, 2},
+		{"retry after", 1, http.StatusServiceUnavailable, "0", http.StatusOK, 1},
+		// A Retry-After of an hour is capped at MaxBackoff, the request
+		// would otherwise run into the timeout of getWithRetries
+		{"long retry after", 1, http.StatusTooManyRequests, "3600", http.StatusOK, 1},
+		{"too many failures", 4, http.StatusServiceUnavailable, "", http.StatusServiceUnavailable, 3},
+		{"not retryable", 1, http.StatusBadRequest, "", http.StatusBadRequest, 0},
+	}
+
+	for _, test := range tests {
+		server := newTestServer(t)
+		server.Fail(retryEndpoint, test.failures, test.status, test.retryAfter)
+
+		transport := netboxclient.NewRetryTransport(nil, 3, time.Millisecond, 10*time.Millisecond)
+
+		status := getWithRetries(t, server, transport)
+		if status != test.expected {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expected, status)
+		}
+		if transport.Retries() != test.retries {
+			t.Errorf("%s: expected %d retries, got %d", test.name, test.retries, transport.Retries())
+		}
+		if n := server.Requests(retryEndpoint); n != int(test.retries)+1 {
+			t.Errorf("%s: expected %d requests, got %d", test.name, test.retries+1, n)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package netboxclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client/dcim"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client/extras"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client/ipam"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client/tenancy"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client/virtualization"
+)
+
+// SnapshotVersion is increased whenever the layout of Snapshot changes in
+// an incompatible way
+const SnapshotVersion = 1
+
+// Snapshot contains all collections fetched by a NetboxClient, and can be
+// used to run the generators without access to the api
+type Snapshot struct {
+	Version         int                                                     `json:"version"`
+	Created         time.Time                                               `json:"created"`
+	Prefixes        *ipam.IpamPrefixesListOKBody                            `json:"prefixes,omitempty"`
+	IpAddresses     *ipam.IpamIPAddressesListOKBody                         `json:"ip_addresses,omitempty"`
+	Devices         *dcim.DcimDevicesListOKBody                             `json:"devices,omitempty"`
+	VirtualMachines *virtualization.VirtualizationVirtualMachinesListOKBody `json:"virtual_machines,omitempty"`
+	ConfigContexts  *extras.ExtrasConfigContextListOKBody                   `json:"config_contexts,omitempty"`
+	Tenants         *tenancy.TenancyTenantsListOKBody                       `json:"tenants,omitempty"`
+	Services        *ipam.IpamServicesListOKBody                            `json:"services,omitempty"`
+}
+
+// NewNetboxClientFromSnapshot returns an offline client which serves all
+// collections from the snapshot stored in fname
+func NewNetboxClientFromSnapshot(fname string) (*NetboxClient, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	snapshot := Snapshot{}
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", snapshot.Version)
+	}
+
+	c := &NetboxClient{
+		offline: true,
+		filters: common.DefaultFilters(),
+	}
+
+	if snapshot.Prefixes != nil {
+		c.ipamPrefixesList = &ipam.IpamPrefixesListOK{Payload: snapshot.Prefixes}
+	}
+	if snapshot.IpAddresses != nil {
+		c.ipamIpAddressesList = &ipam.IpamIPAddressesListOK{Payload: snapshot.IpAddresses}
+	}
+	if snapshot.Devices != nil {
+		c.dcimDevicesList = &dcim.DcimDevicesListOK{Payload: snapshot.Devices}
+	}
+	if snapshot.VirtualMachines != nil {
+		c.virtualMachinesList = &virtualization.VirtualizationVirtualMachinesListOK{Payload: snapshot.VirtualMachines}
+	}
+	if snapshot.ConfigContexts != nil {
+		c.configContextList = &extras.ExtrasConfigContextListOK{Payload: snapshot.ConfigContexts}
+	}
+	if snapshot.Tenants != nil {
+		c.tenantList = &tenancy.TenancyTenantsListOK{Payload: snapshot.Tenants}
+	}
+	if snapshot.Services != nil {
+		c.ipamServicesList = &ipam.IpamServicesListOK{Payload: snapshot.Services}
+	}
+
+	return c, nil
+}
+
+// Snapshot returns all collections which have been fetched so far
+func (c *NetboxClient) Snapshot() Snapshot {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	snapshot := Snapshot{
+		Version: SnapshotVersion,
+		Created: time.Now().UTC(),
+	}
+
+	if c.ipamPrefixesList != nil {
+		snapshot.Prefixes = c.ipamPrefixesList.Payload
+	}
+	if c.ipamIpAddressesList != nil {
+		snapshot.IpAddresses = c.ipamIpAddressesList.Payload
+	}
+	if c.dcimDevicesList != nil {
+		snapshot.Devices = c.dcimDevicesList.Payload
+	}
+	if c.virtualMachinesList != nil {
+		snapshot.VirtualMachines = c.virtualMachinesList.Payload
+	}
+	if c.configContextList != nil {
+		snapshot.ConfigContexts = c.configContextList.Payload
+	}
+	if c.tenantList != nil {
+		snapshot.Tenants = c.tenantList.Payload
+	}
+	if c.ipamServicesList != nil {
+		snapshot.Services = c.ipamServicesList.Payload
+	}
+
+	return snapshot
+}
+
+// WriteSnapshot stores all collections which have been fetched so far in
+// fname
+func (c *NetboxClient) WriteSnapshot(fname string) error {
+	data, err := json.MarshalIndent(c.Snapshot(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %v", err)
+	}
+
+	err = ioutil.WriteFile(fname+".new", data, 0644)
+	if err != nil {
+		return fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+
+	err = os.Rename(fname+".new", fname)
+	if err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+	fmt.Printf("[+] Wrote %s\n", fname)
+
+	return nil
+}
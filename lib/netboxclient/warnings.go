@@ -0,0 +1,83 @@
+package netboxclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+)
+
+const (
+	ObjectDevice         = "dcim.device"
+	ObjectVirtualMachine = "virtualization.virtual-machine"
+	ObjectPrefix         = "ipam.prefix"
+	ObjectIpAddress      = "ipam.ip-address"
+	ObjectConfigContext  = "extras.config-context"
+	ObjectTenant         = "tenancy.tenant"
+	ObjectService        = "ipam.service"
+)
+
+// warn records a problem with a NetBox object. Every warning is only
+// recorded once, since the same collection is often mapped multiple times.
+func (c *NetboxClient) warn(object string, id int64, name string, format string, args ...interface{}) {
+	c.AddWarnings(common.Warning{
+		Object:  object,
+		ID:      id,
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// AddWarnings records problems with NetBox objects found outside of the
+// client, like records which a generator could not derive from an object
+func (c *NetboxClient) AddWarnings(warnings ...common.Warning) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, w := range warnings {
+		seen := false
+		for _, existing := range c.warnings {
+			if existing == w {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			c.warnings = append(c.warnings, w)
+		}
+	}
+}
+
+// Warnings returns all problems found while mapping NetBox objects
+func (c *NetboxClient) Warnings() []common.Warning {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	warnings := make([]common.Warning, len(c.warnings))
+	copy(warnings, c.warnings)
+
+	return warnings
+}
+
+// objectPaths maps the object types used in warnings to their path, which is
+// the same in the api and in the web interface
+var objectPaths map[string]string = map[string]string{
+	ObjectDevice:         "dcim/devices",
+	ObjectVirtualMachine: "virtualization/virtual-machines",
+	ObjectPrefix:         "ipam/prefixes",
+	ObjectIpAddress:      "ipam/ip-addresses",
+	ObjectConfigContext:  "extras/config-contexts",
+	ObjectTenant:         "tenancy/tenants",
+	ObjectService:        "ipam/services",
+}
+
+// WebURL returns the url of object id in the web interface of the NetBox
+// instance at baseURL
+func WebURL(baseURL, object string, id int64) string {
+	path, ok := objectPaths[object]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s/%d/", strings.TrimSuffix(baseURL, "/"), path, id)
+}
@@ -0,0 +1,277 @@
+// Package netboxtest provides an in-process fake NetBox server which serves
+// the NetBox 2.3 list endpoints used by netboxclient from fixture files.
+package netboxtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	httptransport "github.com/go-openapi/runtime/client"
+
+	"github.com/r3boot/as65342-netbox/lib/common"
+	"github.com/r3boot/as65342-netbox/lib/netbox/client"
+	"github.com/r3boot/as65342-netbox/lib/netboxclient"
+)
+
+const (
+	DefaultToken       = "0123456789abcdef0123456789abcdef01234567"
+	DefaultPageSize    = 50
+	DefaultMaxPageSize = 1000
+)
+
+// Endpoints maps the api endpoints served by Server to the name of the
+// fixture file containing its objects
+var Endpoints map[string]string = map[string]string{
+	"/dcim/devices/":                    "devices.json",
+	"/virtualization/virtual-machines/": "virtual-machines.json",
+	"/ipam/prefixes/":                   "prefixes.json",
+	"/ipam/ip-addresses/":               "ip-addresses.json",
+	"/extras/config-contexts/":          "config-contexts.json",
+	"/tenancy/tenants/":                 "tenants.json",
+	"/ipam/services/":                   "services.json",
+}
+
+type listResponse struct {
+	Count    int               `json:"count"`
+	Next     *string           `json:"next"`
+	Previous *string           `json:"previous"`
+	Results  []json.RawMessage `json:"results"`
+}
+
+// Server is a fake NetBox api. Requests need to carry Token, and list
+// endpoints are paginated using limit and offset in the same way as NetBox
+// does, with MaxPageSize taking the role of MAX_PAGE_SIZE.
+type Server struct {
+	*httptest.Server
+	Token       string
+	MaxPageSize int
+	objects     map[string][]json.RawMessage
+	mutex       sync.Mutex
+	requests    map[string]int
+	failures    map[string][]failure
+}
+
+// failure is an error response returned instead of the objects of an
+// endpoint
+type failure struct {
+	status     int
+	retryAfter string
+}
+
+// FixtureDir returns the directory containing the fixtures which are
+// shipped with this package
+func FixtureDir() string {
+	_, fname, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(fname), "testdata")
+}
+
+// NewServer starts a server which serves the fixtures found in dir
+func NewServer(dir string) (*Server, error) {
+	s := &Server{
+		Token:       DefaultToken,
+		MaxPageSize: DefaultMaxPageSize,
+		objects:     make(map[string][]json.RawMessage),
+		requests:    make(map[string]int),
+		failures:    make(map[string][]failure),
+	}
+
+	for endpoint, fname := range Endpoints {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fname))
+		if err != nil {
+			return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
+		}
+
+		objects := []json.RawMessage{}
+		err = json.Unmarshal(data, &objects)
+		if err != nil {
+			return nil, fmt.Errorf("json.Unmarshal %s: %v", fname, err)
+		}
+		s.objects[endpoint] = objects
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s, nil
+}
+
+// Host returns the host:port on which the server listens
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// Client returns a NetboxClient which talks to this server
+func (s *Server) Client(pageSize int64) (*netboxclient.NetboxClient, error) {
+	transport := httptransport.New(s.Host(), client.DefaultBasePath, []string{"http"})
+	return netboxclient.NewNetboxClient(
+		client.New(transport, nil),
+		common.NewTokenAuth(s.Token),
+		pageSize,
+	)
+}
+
+// Requests returns the number of requests made for endpoint
+func (s *Server) Requests(endpoint string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[endpoint]
+}
+
+// Objects returns the objects served on endpoint
+func (s *Server) Objects(endpoint string) []json.RawMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]json.RawMessage{}, s.objects[endpoint]...)
+}
+
+// SetObjects replaces the objects served on endpoint, which allows tests to
+// change the data between requests
+func (s *Server) SetObjects(endpoint string, objects []json.RawMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[endpoint] = objects
+}
+
+// Fail makes the next count requests for endpoint fail with status. If
+// retryAfter is not empty, it is sent as the Retry-After header.
+func (s *Server) Fail(endpoint string, count int, status int, retryAfter string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := 0; i < count; i++ {
+		s.failures[endpoint] = append(s.failures[endpoint], failure{status, retryAfter})
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Token "+s.Token {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"detail": "Invalid token",
+		})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{
+			"detail": fmt.Sprintf("Method \"%s\" not allowed.", r.Method),
+		})
+		return
+	}
+
+	endpoint := strings.TrimPrefix(r.URL.Path, client.DefaultBasePath)
+	s.mutex.Lock()
+	objects, ok := s.objects[endpoint]
+	var failures []failure
+	if ok {
+		s.requests[endpoint]++
+		failures = s.failures[endpoint]
+		if len(failures) > 0 {
+			s.failures[endpoint] = failures[1:]
+		}
+	}
+	s.mutex.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"detail": "Not found.",
+		})
+		return
+	}
+
+	if len(failures) > 0 {
+		if failures[0].retryAfter != "" {
+			w.Header().Set("Retry-After", failures[0].retryAfter)
+		}
+		writeJSON(w, failures[0].status, map[string]string{
+			"detail": http.StatusText(failures[0].status),
+		})
+		return
+	}
+
+	limit, err := queryInt(r, "limit", DefaultPageSize)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+	if limit <= 0 || limit > s.MaxPageSize {
+		limit = s.MaxPageSize
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": err.Error()})
+		return
+	}
+
+	response := listResponse{
+		Count:   len(objects),
+		Results: []json.RawMessage{},
+	}
+
+	if offset < len(objects) {
+		end := offset + limit
+		if end > len(objects) {
+			end = len(objects)
+		}
+		response.Results = objects[offset:end]
+	}
+
+	if offset+limit < len(objects) {
+		next := s.pageURL(r, limit, offset+limit)
+		response.Next = &next
+	}
+
+	if offset > 0 {
+		previous := offset - limit
+		if previous < 0 {
+			previous = 0
+		}
+		prev := s.pageURL(r, limit, previous)
+		response.Previous = &prev
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) pageURL(r *http.Request, limit, offset int) string {
+	query := r.URL.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     r.Host,
+		Path:     path.Clean(r.URL.Path) + "/",
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+
+	return result, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}